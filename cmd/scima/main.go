@@ -2,31 +2,52 @@
 package main
 
 import (
+	"archive/zip"
 	"context"
-	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
-	_ "github.com/lib/pq" // postgres driver
+	_ "github.com/go-sql-driver/mysql" // mysql driver
+	_ "github.com/lib/pq"              // postgres driver
 	"github.com/scima/scima/internal/config"
-	"github.com/scima/scima/internal/dialect"
-	"github.com/scima/scima/internal/migrate"
+	"github.com/scima/scima/internal/logging"
+	"github.com/scima/scima/scima"
 	"github.com/spf13/cobra"
+	_ "modernc.org/sqlite" // sqlite driver (pure Go)
 )
 
 var rootCmd = &cobra.Command{Use: "scima", Short: "Schema migrations for multiple databases (HANA first)"}
 
 var driver string
 var configPath string
+var envName string
 var dsn string
+var dsnFile string
 var migrationsDir string
+var source string
 var schema string // optional schema qualification
+var lockTimeout time.Duration
+var logFormat string
+var logLevel string
+var allowOutOfOrder bool
 
 func addGlobalFlags(cmd *cobra.Command) {
-	cmd.PersistentFlags().StringVar(&driver, "driver", "hana", "Database driver/dialect (hana, pg, mysql, sqlite, etc.)")
-	cmd.PersistentFlags().StringVar(&dsn, "dsn", "", "Database DSN / connection string")
+	cmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file (default: first of ./scima.yaml, ./scima.yml, ./scima.json, ./scima.toml)")
+	cmd.PersistentFlags().StringVar(&envName, "env", "", "Environment profile from the config file's environments section (default $SCIMA_ENV)")
+	cmd.PersistentFlags().StringVar(&driver, "driver", "hana", "Database driver/dialect (hana, postgres, mysql, sqlite)")
+	cmd.PersistentFlags().StringVar(&dsn, "dsn", "", "Database DSN / connection string, or a secret reference (file://<path>, env://<VAR>, exec://<helper>)")
+	cmd.PersistentFlags().StringVar(&dsnFile, "dsn-file", "", "File holding the DSN, e.g. a mounted secret, read whatever the driver")
+	cmd.MarkFlagsMutuallyExclusive("dsn", "dsn-file")
 	cmd.PersistentFlags().StringVar(&migrationsDir, "migrations-dir", "./migrations", "Directory containing migration files")
+	cmd.PersistentFlags().StringVar(&source, "source", "", "Migration source, dir:<path> or zip:<file>; overrides --migrations-dir")
+	cmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Format of the migration events logged to stderr (text, json)")
+	cmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Lowest level of migration events to log (debug, info, warn, error); debug adds every statement")
 	cmd.PersistentFlags().StringVar(&schema, "schema", "", "Optional database schema for migration tracking table and SQL placeholders ({{schema}}, {{schema?}})")
 }
 
@@ -37,21 +58,47 @@ func init() {
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(upCmd)
 	rootCmd.AddCommand(downCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().StringVar(&historyFormat, "format", "text", "Output format (text, json)")
+	rootCmd.AddCommand(unlockCmd)
+	rootCmd.AddCommand(forceCmd)
+	rootCmd.AddCommand(createCmd)
+	createCmd.Flags().Int64Var(&createStep, "step", 10, "Version increment for sequential versions")
+	createCmd.Flags().BoolVar(&createTimestamp, "timestamp", false, "Use a UTC timestamp (YYYYMMDDHHMMSS) as the version")
+	createCmd.Flags().StringVar(&createTemplate, "template", "", "File with a text/template header for new migrations ({{.Version}}, {{.Name}}, {{.Direction}})")
+	rootCmd.AddCommand(generateScriptCmd)
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+	configShowCmd.Flags().StringVar(&configFormat, "format", "text", "Output format (text, json)")
+	generateScriptCmd.Flags().StringVar(&scriptFrom, "from", "", "First version to include (default: oldest)")
+	generateScriptCmd.Flags().StringVar(&scriptTo, "to", "", "Last version to include (default: newest)")
+	generateScriptCmd.Flags().BoolVar(&scriptDown, "down", false, "Render the down migrations of the range, newest first")
+	forceCmd.Flags().StringVar(&forceState, "state", "applied", "State to record for the version (applied, pending)")
+	upCmd.Flags().StringVar(&upTo, "to", "", "Apply pending migrations up to and including this version")
+	upCmd.Flags().IntVar(&upSteps, "steps", 0, "Number of pending migrations to apply (default 0=all)")
+	rootCmd.AddCommand(gotoCmd)
+	for _, cmd := range []*cobra.Command{upCmd, gotoCmd} {
+		cmd.Flags().BoolVar(&allowOutOfOrder, "allow-out-of-order", false, "Apply pending migrations older than the latest applied version")
+	}
 	downCmd.Flags().IntVar(&steps, "steps", 1, "Number of migration steps to revert (default 1, 0=all)")
+	for _, cmd := range []*cobra.Command{upCmd, downCmd, gotoCmd} {
+		cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the statements that would run, including bookkeeping, without executing them")
+		cmd.Flags().StringVar(&planOutput, "output", "text", "Dry run output format (text, sql)")
+	}
+	for _, cmd := range []*cobra.Command{upCmd, downCmd, gotoCmd, forceCmd} {
+		cmd.Flags().DurationVar(&lockTimeout, "lock-timeout", time.Minute, "How long to wait for another scima run to release the migration lock")
+	}
+	redactErrors(rootCmd)
 }
 
 var initCmd = &cobra.Command{Use: "init", Short: "Initialize migration tracking table", RunE: func(_ *cobra.Command, _ []string) error {
-	cfg := gatherConfig()
-	migr, db, err := buildMigrator(cfg)
+	m, closeMigrator, err := openMigrator()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "error closing db: %v\n", err)
-		}
-	}()
-	if err := migr.EnsureMigrationTable(context.Background()); err != nil {
+	defer closeMigrator()
+	if err := m.Init(context.Background()); err != nil {
 		return err
 	}
 	fmt.Println("migration table ensured")
@@ -59,160 +106,496 @@ var initCmd = &cobra.Command{Use: "init", Short: "Initialize migration tracking
 }}
 
 var statusCmd = &cobra.Command{Use: "status", Short: "Show current and pending migrations", RunE: func(_ *cobra.Command, _ []string) error {
-	cfg := gatherConfig()
-	migr, db, err := buildMigrator(cfg)
+	m, closeMigrator, err := openMigrator()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "error closing db: %v\n", err)
-		}
-	}()
-	pairs, err := migrate.ScanDir(cfg.MigrationsDir)
+	defer closeMigrator()
+	st, err := m.Status(context.Background())
 	if err != nil {
 		return err
 	}
-	if err := migrate.Validate(pairs); err != nil {
+	fmt.Print(st)
+	return nil
+}}
+
+var validateCmd = &cobra.Command{Use: "validate", Short: "Verify applied migrations still match their files", RunE: func(_ *cobra.Command, _ []string) error {
+	m, closeMigrator, err := openMigrator()
+	if err != nil {
 		return err
 	}
-	applied, err := migr.Status(context.Background())
+	defer closeMigrator()
+	mismatches, err := m.Verify(context.Background())
 	if err != nil {
 		return err
 	}
-	fmt.Print(migrate.PrettyPrint(pairs, applied))
+	for _, mm := range mismatches {
+		fmt.Printf("%04d\t%s\tchecksum mismatch: applied %s, file %s (%s)\n", mm.Version, mm.Name, mm.Applied, mm.Current, mm.FullPath)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d applied migration(s) changed since they were applied", len(mismatches))
+	}
+	fmt.Println("all applied migrations match their files")
 	return nil
 }}
 
-var upCmd = &cobra.Command{Use: "up", Short: "Apply pending up migrations", RunE: func(_ *cobra.Command, _ []string) error {
-	cfg := gatherConfig()
-	migr, db, err := buildMigrator(cfg)
+var dryRun bool
+var planOutput string
+
+// checkPlanOutput validates --output before anything connects to the database.
+func checkPlanOutput() error {
+	if planOutput != "text" && planOutput != "sql" {
+		return fmt.Errorf("unknown output %q (want text or sql)", planOutput)
+	}
+	return nil
+}
+
+// printPlan prints a dry run in the format chosen with --output.
+func printPlan(plan *scima.Plan, err error) error {
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "error closing db: %v\n", err)
-		}
-	}()
-	pairs, err := migrate.ScanDir(cfg.MigrationsDir)
+	if planOutput == "sql" {
+		fmt.Print(plan.Script())
+	} else {
+		fmt.Print(plan.String())
+	}
+	return nil
+}
+
+// parseVersion parses a migration version as written in file names, so a
+// zero-padded version such as 0040 is decimal 40.
+func parseVersion(s string) (int64, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("invalid version %q: %w", s, err)
 	}
-	if err := migrate.Validate(pairs); err != nil {
+	return v, nil
+}
+
+var upTo string
+var upSteps int
+var upCmd = &cobra.Command{Use: "up", Short: "Apply pending up migrations", RunE: func(cmd *cobra.Command, _ []string) error {
+	toSet := cmd.Flags().Changed("to")
+	if toSet && upSteps != 0 {
+		return errors.New("--to and --steps cannot be combined")
+	}
+	var target int64
+	if toSet {
+		var err error
+		if target, err = parseVersion(upTo); err != nil {
+			return err
+		}
+	}
+	if err := checkPlanOutput(); err != nil {
 		return err
 	}
-	applied, err := migr.Status(context.Background())
+	m, closeMigrator, err := openMigrator()
 	if err != nil {
 		return err
 	}
-	pending := migrate.FilterPending(pairs, applied)
+	defer closeMigrator()
+	if dryRun {
+		if toSet {
+			return printPlan(m.PlanUpTo(context.Background(), target))
+		}
+		return printPlan(m.PlanUp(context.Background(), upSteps))
+	}
 	start := time.Now()
-	if err := migr.ApplyUp(context.Background(), pending); err != nil {
+	var applied []scima.Migration
+	if toSet {
+		applied, err = m.UpTo(context.Background(), target)
+	} else {
+		applied, err = m.UpSteps(context.Background(), upSteps)
+	}
+	if err != nil {
 		return err
 	}
-	fmt.Printf("applied %d migrations in %s\n", len(pending), time.Since(start))
+	fmt.Printf("applied %d migrations in %s\n", len(applied), time.Since(start))
 	return nil
 }}
 
-var steps int
-var downCmd = &cobra.Command{Use: "down", Short: "Revert migrations (default 1 step)", RunE: func(_ *cobra.Command, _ []string) error {
-	cfg := gatherConfig()
-	migr, db, err := buildMigrator(cfg)
+var historyFormat string
+var historyCmd = &cobra.Command{Use: "history", Short: "Show who applied which migrations and when", RunE: func(_ *cobra.Command, _ []string) error {
+	m, closeMigrator, err := openMigrator()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "error closing db: %v\n", err)
-		}
-	}()
-	pairs, err := migrate.ScanDir(cfg.MigrationsDir)
+	defer closeMigrator()
+	rows, err := m.History(context.Background())
 	if err != nil {
 		return err
 	}
-	if err := migrate.Validate(pairs); err != nil {
+	switch historyFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case "text":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT\tDURATION\tAPPLIED BY\tDB USER\tHOST\tSCIMA")
+		for _, r := range rows {
+			appliedAt := ""
+			if !r.AppliedAt.IsZero() {
+				appliedAt = r.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			version := fmt.Sprintf("%04d", r.Version)
+			if r.Repeatable() {
+				version = "R"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", version, r.Name, appliedAt, r.Duration, r.AppliedBy, r.DBUser, r.Hostname, r.ScimaVersion)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q (want text or json)", historyFormat)
+	}
+}}
+
+var steps int
+var downCmd = &cobra.Command{Use: "down", Short: "Revert migrations (default 1 step)", RunE: func(_ *cobra.Command, _ []string) error {
+	if err := checkPlanOutput(); err != nil {
 		return err
 	}
-	applied, err := migr.Status(context.Background())
+	m, closeMigrator, err := openMigrator()
+	if err != nil {
+		return err
+	}
+	defer closeMigrator()
+	if dryRun {
+		return printPlan(m.PlanDown(context.Background(), steps))
+	}
+	start := time.Now()
+	downs, err := m.Down(context.Background(), steps)
 	if err != nil {
 		return err
 	}
-	downs := migrate.ReverseForDown(pairs, applied, steps)
 	if len(downs) == 0 {
 		fmt.Println("no migrations to revert")
 		return nil
 	}
+	fmt.Printf("reverted %d migrations in %s\n", len(downs), time.Since(start))
+	return nil
+}}
+
+var gotoCmd = &cobra.Command{Use: "goto <version>", Short: "Migrate up or down until the given version is the latest applied (0 reverts all)", Args: cobra.ExactArgs(1), RunE: func(_ *cobra.Command, args []string) error {
+	target, err := parseVersion(args[0])
+	if err != nil {
+		return err
+	}
+	if err := checkPlanOutput(); err != nil {
+		return err
+	}
+	m, closeMigrator, err := openMigrator()
+	if err != nil {
+		return err
+	}
+	defer closeMigrator()
+	if dryRun {
+		return printPlan(m.PlanTo(context.Background(), target))
+	}
 	start := time.Now()
-	if err := migr.ApplyDown(context.Background(), downs); err != nil {
+	ran, err := m.MigrateTo(context.Background(), target)
+	if err != nil {
 		return err
 	}
-	fmt.Printf("reverted %d migrations in %s\n", len(downs), time.Since(start))
+	var ups, downs int
+	for _, f := range ran {
+		if f.Direction == "up" {
+			ups++
+		} else {
+			downs++
+		}
+	}
+	fmt.Printf("at version %d: applied %d, reverted %d migrations in %s\n", target, ups, downs, time.Since(start))
 	return nil
 }}
 
-func gatherConfig() config.Config {
-	// Try config file first if provided or default locations
-	var cfg *config.Config
-	if configPath != "" {
-		cfg, _ = config.LoadConfig(configPath)
-	} else {
-		// Try default locations
-		for _, path := range []string{"./scima.yaml", "./scima.yml", "./scima.json", "./scima.toml"} {
-			cfg, _ = config.LoadConfig(path)
-			if cfg != nil {
-				break
-			}
+var unlockCmd = &cobra.Command{Use: "unlock", Short: "Clear a stale migration lock left by a crashed run", RunE: func(_ *cobra.Command, _ []string) error {
+	m, closeMigrator, err := openMigrator()
+	if err != nil {
+		return err
+	}
+	defer closeMigrator()
+	if err := m.Unlock(context.Background()); err != nil {
+		return err
+	}
+	fmt.Println("migration lock cleared")
+	return nil
+}}
+
+var forceState string
+var forceCmd = &cobra.Command{Use: "force <version>", Short: "Record a version as applied or pending after manually repairing a failed migration", Args: cobra.ExactArgs(1), RunE: func(_ *cobra.Command, args []string) error {
+	version, err := parseVersion(args[0])
+	if err != nil {
+		return err
+	}
+	if forceState != "applied" && forceState != "pending" {
+		return fmt.Errorf("unknown state %q (want applied or pending)", forceState)
+	}
+	m, closeMigrator, err := openMigrator()
+	if err != nil {
+		return err
+	}
+	defer closeMigrator()
+	if err := m.Force(context.Background(), version, forceState == "applied"); err != nil {
+		return err
+	}
+	fmt.Printf("version %d recorded as %s\n", version, forceState)
+	return nil
+}}
+
+var createStep int64
+var createTimestamp bool
+var createTemplate string
+var createCmd = &cobra.Command{Use: "create <description>", Short: "Create the up and down files for a new migration", Args: cobra.MinimumNArgs(1), RunE: func(_ *cobra.Command, args []string) error {
+	cfg, err := gatherConfig()
+	if err != nil {
+		return err
+	}
+	dir := cfg.MigrationsDir
+	if cfg.Source != "" {
+		kind, location, _ := strings.Cut(cfg.Source, ":")
+		if kind != "dir" {
+			return fmt.Errorf("create needs a directory source, got %q", cfg.Source)
+		}
+		dir = location
+	}
+	opts := scima.CreateOptions{Step: createStep, Timestamp: createTimestamp}
+	if createTemplate != "" {
+		tmpl, err := os.ReadFile(createTemplate)
+		if err != nil {
+			return err
+		}
+		opts.Template = string(tmpl)
+	}
+	files, err := scima.Create(dir, strings.Join(args, " "), opts)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Println("created", f)
+	}
+	return nil
+}}
+
+var scriptFrom, scriptTo string
+var scriptDown bool
+var generateScriptCmd = &cobra.Command{Use: "generate-script", Short: "Print a guarded SQL script of the migrations for a DBA to run; needs no database connection", RunE: func(cmd *cobra.Command, _ []string) error {
+	var sel scima.ScriptOptions
+	if cmd.Flags().Changed("from") {
+		from, err := parseVersion(scriptFrom)
+		if err != nil {
+			return err
+		}
+		sel.From = from
+	}
+	if cmd.Flags().Changed("to") {
+		to, err := parseVersion(scriptTo)
+		if err != nil {
+			return err
+		}
+		sel.To = to
+	}
+	sel.Down = scriptDown
+	cfg, err := gatherConfig()
+	if err != nil {
+		return err
+	}
+	src, closeSource, err := sourceOption(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+	script, err := scima.GenerateScript(sel,
+		src,
+		scima.WithDialect(cfg.Driver),
+		scima.WithSchema(cfg.Schema),
+	)
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}}
+
+var configCmd = &cobra.Command{Use: "config", Short: "Inspect the configuration"}
+
+var configFormat string
+var configShowCmd = &cobra.Command{Use: "show", Short: "Show the effective configuration and where each value comes from", Args: cobra.NoArgs, RunE: func(_ *cobra.Command, _ []string) error {
+	_, settings, err := config.Resolve(configOptions())
+	if err != nil {
+		return err
+	}
+	for i, s := range settings {
+		if s.Key == "dsn" {
+			settings[i].Value = config.RedactDSN(s.Value)
 		}
-		if cfg == nil {
-			cfg = &config.Config{}
+		if s.Source == "flag" {
+			settings[i].Source = "flag --" + changedFlag(s.Key)
 		}
 	}
-	// CLI flags override config file
-	if driver != "" {
-		cfg.Driver = driver
+	switch configFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(settings)
+	case "text":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+		for _, s := range settings {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Key, s.Value, s.Source)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q (want text or json)", configFormat)
 	}
-	if dsn != "" {
-		cfg.DSN = dsn
+}}
+
+// configFlags maps the flags that override config values to their config keys.
+var configFlags = map[string]string{
+	"driver":         "driver",
+	"dsn":            "dsn",
+	"migrations-dir": "migrationsdir",
+	"source":         "source",
+	"schema":         "schema",
+}
+
+// changedFlag returns the name of the flag that set the config key on the command line.
+func changedFlag(key string) string {
+	if key == "dsn" && rootCmd.PersistentFlags().Changed("dsn-file") {
+		return "dsn-file"
 	}
-	if migrationsDir != "" {
-		cfg.MigrationsDir = migrationsDir
+	for name, k := range configFlags {
+		if k == key {
+			return name
+		}
 	}
-	if schema != "" {
-		cfg.Schema = schema
+	return key
+}
+
+// configOptions returns what gatherConfig loads: the --config file and --env
+// profile, and the flags set on the command line, which override the rest.
+func configOptions() config.Options {
+	flags := make(map[string]string)
+	for name, key := range configFlags {
+		if f := rootCmd.PersistentFlags().Lookup(name); f != nil && f.Changed {
+			flags[key] = f.Value.String()
+		}
+	}
+	return config.Options{Path: configPath, Env: envName, Flags: flags, DSNFile: dsnFile}
+}
+
+// gatherConfig loads the effective configuration: flags set on the command line
+// override SCIMA_* environment variables, the --env profile, the config file and
+// the defaults, in that order.
+func gatherConfig() (config.Config, error) {
+	cfg, err := config.Load(configOptions())
+	if err != nil {
+		return config.Config{}, err
 	}
-	return *cfg
+	return *cfg, nil
 }
 
-func buildMigrator(cfg config.Config) (*migrate.Migrator, *sql.DB, error) {
-	dial, err := dialect.Get(cfg.Driver)
+// openMigrator opens the configured database and migration source through the
+// scima package. The returned func closes both.
+func openMigrator() (*scima.Migrator, func(), error) {
+	cfg, err := gatherConfig()
 	if err != nil {
 		return nil, nil, err
 	}
-	if cfg.DSN == "" {
-		return nil, nil, fmt.Errorf("dsn required")
+	openedDSN = cfg.DSN
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		return nil, nil, err
 	}
-	db, err := sql.Open(driverNameFor(cfg.Driver), cfg.DSN)
+	handler, err := logging.NewHandler(os.Stderr, logFormat, level)
 	if err != nil {
 		return nil, nil, err
 	}
-	return migrate.NewMigrator(dial, dialect.SQLConn{DB: db}, schema), db, nil
+	src, closeSource, err := sourceOption(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := scima.Open(cfg.Driver, cfg.DSN,
+		src,
+		scima.WithSchema(cfg.Schema),
+		scima.WithLogHandler(handler),
+		scima.WithLockTimeout(lockTimeout),
+		scima.WithAllowOutOfOrder(allowOutOfOrder),
+	)
+	if err != nil {
+		closeSource()
+		return nil, nil, err
+	}
+	return m, func() {
+		if err := m.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "error closing db: %v\n", err)
+		}
+		closeSource()
+	}, nil
+}
+
+// openedDSN is the resolved DSN of the database openMigrator opened, which command
+// errors must not reveal.
+var openedDSN string
+
+// redactedError hides the DSN and its password in the message of err, which
+// database drivers may quote, while keeping err for errors.Is and errors.As.
+type redactedError struct {
+	err error
+	dsn string
+}
+
+func (e redactedError) Error() string { return config.Redact(e.err.Error(), e.dsn) }
+
+func (e redactedError) Unwrap() error { return e.err }
+
+// redactErrors makes cmd and its subcommands return errors with openedDSN redacted.
+func redactErrors(cmd *cobra.Command) {
+	if run := cmd.RunE; run != nil {
+		cmd.RunE = func(c *cobra.Command, args []string) error {
+			if err := run(c, args); err != nil {
+				return redactedError{err: err, dsn: openedDSN}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		redactErrors(sub)
+	}
 }
 
-func driverNameFor(driver string) string {
-	switch driver {
-	case "hana":
-		return "hdb"
-	case "postgres", "pg":
-		return "postgres"
+// sourceOption resolves where migrations are read from. A --source of the form
+// dir:<path> or zip:<file> takes precedence over --migrations-dir.
+func sourceOption(cfg config.Config) (scima.Option, func(), error) {
+	kind, location, ok := strings.Cut(cfg.Source, ":")
+	switch {
+	case cfg.Source == "":
+		return scima.WithDir(cfg.MigrationsDir), func() {}, nil
+	case ok && kind == "dir":
+		return scima.WithDir(location), func() {}, nil
+	case ok && kind == "zip":
+		zr, err := zip.OpenReader(location)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open migration source: %w", err)
+		}
+		return scima.WithFS(zr, "."), func() {
+			if err := zr.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "error closing %s: %v\n", location, err)
+			}
+		}, nil
 	default:
-		return driver // assume same
+		return nil, nil, fmt.Errorf("unknown migration source %q (want dir:<path> or zip:<file>)", cfg.Source)
 	}
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		var me *scima.MigrationError
+		if errors.As(err, &me) {
+			fmt.Fprint(os.Stderr, me.Excerpt())
+		}
 		os.Exit(1)
 	}
 }
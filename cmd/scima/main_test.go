@@ -1,6 +1,72 @@
 package main
 
-import "testing"
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scima/scima/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// execute runs the CLI with args and returns what it printed to stdout. Flags
+// start from their defaults and are reset again when the test ends.
+func execute(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	resetFlags(rootCmd)
+	t.Cleanup(func() { resetFlags(rootCmd) })
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	rootCmd.SetArgs(args)
+	runErr := rootCmd.Execute()
+	os.Stdout = stdout
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), runErr
+}
+
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		_ = f.Value.Set(f.DefValue)
+		f.Changed = false
+	}
+	cmd.PersistentFlags().VisitAll(reset)
+	cmd.Flags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+func writeMigrations(t *testing.T, versions ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, v := range versions {
+		files := map[string]string{
+			v + "_t" + v + ".up.sql":   "CREATE TABLE t" + v + " (id INTEGER);",
+			v + "_t" + v + ".down.sql": "DROP TABLE t" + v + ";",
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dir
+}
 
 func TestRootCmdRequiresDSN(t *testing.T) {
 	rootCmd.SetArgs([]string{"status"})
@@ -8,3 +74,127 @@ func TestRootCmdRequiresDSN(t *testing.T) {
 		t.Fatalf("expected error due to missing dsn")
 	}
 }
+
+func TestSourceOption(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "migrations.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("0010_init.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("CREATE TABLE t (id INTEGER);")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, src := range []string{"", "dir:./migrations", "zip:" + archive} {
+		opt, closeSource, err := sourceOption(config.Config{MigrationsDir: "./migrations", Source: src})
+		if err != nil || opt == nil {
+			t.Fatalf("source %q: %v", src, err)
+		}
+		closeSource()
+	}
+	for _, src := range []string{"ftp:host", "zip:" + archive + ".missing"} {
+		if _, _, err := sourceOption(config.Config{Source: src}); err == nil {
+			t.Fatalf("expected error for source %q", src)
+		}
+	}
+}
+
+func TestUpToZeroPaddedVersion(t *testing.T) {
+	dir := writeMigrations(t, "0010", "0020", "0030", "0040", "0050", "0080")
+	db := filepath.Join(t.TempDir(), "test.db")
+	if _, err := execute(t, "up", "--driver", "sqlite", "--dsn", db, "--migrations-dir", dir, "--to", "0040"); err != nil {
+		t.Fatalf("up --to 0040: %v", err)
+	}
+	out, err := execute(t, "status", "--driver", "sqlite", "--dsn", db, "--migrations-dir", dir)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if !strings.Contains(out, "0040\tt0040\tapplied") || !strings.Contains(out, "0050\tt0050\tpending") {
+		t.Fatalf("expected 0010-0040 applied and 0050 pending:\n%s", out)
+	}
+	if _, err := execute(t, "up", "--driver", "sqlite", "--dsn", db, "--migrations-dir", dir, "--to", "0080"); err != nil {
+		t.Fatalf("up --to 0080: %v", err)
+	}
+	if _, err := execute(t, "up", "--driver", "sqlite", "--dsn", db, "--migrations-dir", dir, "--to", "0x50"); err == nil {
+		t.Fatalf("expected error for non-decimal version")
+	}
+}
+
+func TestSQLiteURIAndDSNFile(t *testing.T) {
+	dir := writeMigrations(t, "0010", "0020")
+	db := filepath.Join(t.TempDir(), "test.db")
+	if _, err := execute(t, "up", "--driver", "sqlite", "--dsn", "file://"+db+"?cache=shared", "--migrations-dir", dir, "--to", "0010"); err != nil {
+		t.Fatalf("up with a sqlite URI: %v", err)
+	}
+	secret := filepath.Join(t.TempDir(), "dsn")
+	if err := os.WriteFile(secret, []byte(db+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := execute(t, "status", "--driver", "sqlite", "--dsn-file", secret, "--migrations-dir", dir)
+	if err != nil {
+		t.Fatalf("status with --dsn-file: %v", err)
+	}
+	if !strings.Contains(out, "0010\tt0010\tapplied") || !strings.Contains(out, "0020\tt0020\tpending") {
+		t.Fatalf("expected 0010 applied through the URI and 0020 pending:\n%s", out)
+	}
+}
+
+func TestGenerateScriptZeroPaddedRange(t *testing.T) {
+	dir := writeMigrations(t, "0010", "0020", "0030", "0040", "0050", "0060", "0080")
+	out, err := execute(t, "generate-script", "--driver", "postgres", "--migrations-dir", dir, "--from", "0030", "--to", "0060")
+	if err != nil {
+		t.Fatalf("generate-script: %v", err)
+	}
+	for _, table := range []string{"t0030", "t0040", "t0050", "t0060"} {
+		if !strings.Contains(out, "CREATE TABLE "+table) {
+			t.Fatalf("script misses %s:\n%s", table, out)
+		}
+	}
+	for _, table := range []string{"t0020", "t0080"} {
+		if strings.Contains(out, "CREATE TABLE "+table) {
+			t.Fatalf("script includes %s outside the range:\n%s", table, out)
+		}
+	}
+	if _, err := execute(t, "generate-script", "--driver", "postgres", "--migrations-dir", dir, "--from", "0080"); err != nil {
+		t.Fatalf("generate-script --from 0080: %v", err)
+	}
+}
+
+func TestConfigShowFlagSources(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "dsn")
+	if err := os.WriteFile(secret, []byte("postgres://app:s3cret@db/app\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--dsn", "postgres://app:s3cret@db/app"}, "flag --dsn"},
+		{[]string{"--dsn-file", secret}, "flag --dsn-file"},
+	} {
+		out, err := execute(t, append([]string{"config", "show", "--format", "json"}, tc.args...)...)
+		if err != nil {
+			t.Fatalf("config show %v: %v", tc.args, err)
+		}
+		var settings []config.Setting
+		if err := json.Unmarshal([]byte(out), &settings); err != nil {
+			t.Fatalf("decode %q: %v", out, err)
+		}
+		for _, st := range settings {
+			if st.Key == "dsn" && st.Source != tc.want {
+				t.Fatalf("config show %v: dsn source %q, want %q", tc.args, st.Source, tc.want)
+			}
+		}
+	}
+}
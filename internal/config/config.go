@@ -2,6 +2,14 @@
 package config
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
 	"github.com/spf13/viper"
 )
 
@@ -11,25 +19,245 @@ type Config struct {
 	DSN           string `mapstructure:"dsn"`
 	MigrationsDir string `mapstructure:"migrationsdir"`
 	Schema        string `mapstructure:"schema"`
+	// Source selects where migrations are read from (dir:<path> or zip:<file>) and
+	// takes precedence over MigrationsDir when set.
+	Source string `mapstructure:"source"`
 }
 
-// LoadConfig uses Viper to load config from file, env, and flags.
-func LoadConfig(configPath string) (*Config, error) {
-	v := viper.New()
-	v.SetConfigFile(configPath)
-	v.SetConfigType(guessType(configPath))
-	v.SetDefault("driver", "hana")
-	v.SetDefault("migrationsdir", "./migrations")
-	if err := v.ReadInConfig(); err != nil {
+// settings lists the config keys in file order, each with its default and the
+// environment variable overriding it.
+var settings = []struct {
+	key, env, def string
+}{
+	{"driver", "SCIMA_DRIVER", "hana"},
+	{"dsn", "SCIMA_DSN", ""},
+	{"migrationsdir", "SCIMA_MIGRATIONS_DIR", "./migrations"},
+	{"schema", "SCIMA_SCHEMA", ""},
+	{"source", "SCIMA_SOURCE", ""},
+}
+
+// DefaultPaths are the config files Load looks for when Options.Path is empty.
+var DefaultPaths = []string{"./scima.yaml", "./scima.yml", "./scima.json", "./scima.toml"}
+
+// Options selects where Load reads configuration from.
+type Options struct {
+	// Path is the config file. When empty, the first of DefaultPaths that exists is
+	// used, and having none is fine.
+	Path string
+	// Env names a profile under "environments" in the config file whose values
+	// override the top-level ones. When empty, SCIMA_ENV is used.
+	Env string
+	// Flags holds the values given on the command line, by config key.
+	Flags map[string]string
+	// DSNFile is a file holding the DSN, such as a mounted secret. It overrides
+	// every other source of the DSN and is read whatever the driver.
+	DSNFile string
+}
+
+// setting is the resolved value of one config key and where it came from.
+type setting struct {
+	value  string
+	source string
+}
+
+// Setting is one value of the effective configuration and where it came from:
+// "flag", "env SCIMA_...", the config file path, optionally followed by the
+// profile, or "default".
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Load resolves the configuration. Each key takes the first value found in the
+// flags, the SCIMA_* environment variables, the selected profile, the top level of
+// the config file and the defaults, in that order. File values may reference
+// environment variables as ${VAR} or ${VAR:-default}; $${ stands for a literal ${.
+// A DSN given as a secret reference is resolved, see ResolveSecret, except that a
+// file:// DSN for the sqlite driver is a SQLite URI naming the database; its
+// secret goes in Options.DSNFile instead.
+func Load(opts Options) (*Config, error) {
+	cfg, _, err := Resolve(opts)
+	if err != nil {
 		return nil, err
 	}
-	// Optionally bind env vars here if desired
-	var cfg Config
-	err := v.Unmarshal(&cfg)
+	if opts.DSNFile == "" && cfg.Driver == "sqlite" && strings.HasPrefix(cfg.DSN, "file://") {
+		return cfg, nil
+	}
+	if cfg.DSN, err = ResolveSecret(context.Background(), cfg.DSN); err != nil {
+		return nil, fmt.Errorf("resolve dsn: %w", err)
+	}
+	return cfg, nil
+}
+
+// Resolve loads the configuration like Load and also returns its settings in file
+// order, each with its source. Secret references are returned as given.
+func Resolve(opts Options) (*Config, []Setting, error) {
+	resolved, err := resolve(opts)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	v := viper.New()
+	list := make([]Setting, 0, len(settings))
+	for _, s := range settings {
+		v.Set(s.key, resolved[s.key].value)
+		list = append(list, Setting{Key: s.key, Value: resolved[s.key].value, Source: resolved[s.key].source})
+	}
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, list, nil
+}
+
+// LoadConfig loads the config file at configPath with environment overrides.
+func LoadConfig(configPath string) (*Config, error) {
+	if configPath == "" {
+		return nil, fmt.Errorf("no config file given")
+	}
+	return Load(Options{Path: configPath})
+}
+
+func resolve(opts Options) (map[string]setting, error) {
+	resolved := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		resolved[s.key] = setting{value: s.def, source: "default"}
+	}
+
+	path := opts.Path
+	if path == "" {
+		for _, p := range DefaultPaths {
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+	}
+	env := opts.Env
+	if env == "" {
+		env = os.Getenv("SCIMA_ENV")
+	}
+	if path == "" && env != "" {
+		return nil, fmt.Errorf("environment %q selected but no config file found", env)
+	}
+
+	if path != "" {
+		v := viper.New()
+		v.SetConfigFile(path)
+		v.SetConfigType(guessType(path))
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("read config %s: %w", path, err)
+		}
+		if err := checkKeys(v.AllKeys()); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+		type layer struct{ prefix, source string }
+		layers := []layer{{"", path}}
+		if env != "" {
+			if !v.IsSet("environments." + env) {
+				return nil, fmt.Errorf("config %s: no environment %q under environments", path, env)
+			}
+			layers = append(layers, layer{"environments." + env + ".", path + " (environments." + env + ")"})
+		}
+		for _, l := range layers {
+			for _, s := range settings {
+				if !v.IsSet(l.prefix + s.key) {
+					continue
+				}
+				value, err := interpolate(v.GetString(l.prefix + s.key))
+				if err != nil {
+					return nil, fmt.Errorf("config %s: %s%s: %w", path, l.prefix, s.key, err)
+				}
+				resolved[s.key] = setting{value: value, source: l.source}
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if value := os.Getenv(s.env); value != "" {
+			resolved[s.key] = setting{value: value, source: "env " + s.env}
+		}
+	}
+	for key, value := range opts.Flags {
+		if _, ok := resolved[key]; !ok {
+			return nil, fmt.Errorf("unknown config key %q", key)
+		}
+		resolved[key] = setting{value: value, source: "flag"}
+	}
+	if opts.DSNFile != "" {
+		resolved["dsn"] = setting{value: "file://" + opts.DSNFile, source: "flag"}
+	}
+	return resolved, nil
+}
+
+// checkKeys reports keys of a config file that are neither settings nor settings
+// inside a profile, so that typos do not go unnoticed.
+func checkKeys(keys []string) error {
+	known := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		known[s.key] = true
+	}
+	var unknown []string
+	for _, k := range keys {
+		if rest, ok := strings.CutPrefix(k, "environments."); ok {
+			if _, key, ok := strings.Cut(rest, "."); ok && known[key] {
+				continue
+			}
+		} else if known[k] {
+			continue
+		}
+		unknown = append(unknown, k)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown key(s) %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+var interpolation = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// interpolate replaces ${VAR} and ${VAR:-default} in s with the value of the
+// environment variable VAR, or default when VAR is unset or empty.
+func interpolate(s string) (string, error) {
+	var err error
+	res := interpolation.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		m := interpolation.FindStringSubmatch(ref)
+		if value := os.Getenv(m[1]); value != "" {
+			return value
+		}
+		if def, ok := strings.CutPrefix(m[2], ":-"); ok {
+			return def
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable %s is not set", m[1])
+		}
+		return ""
+	})
+	return res, err
+}
+
+var (
+	// userinfoPassword matches the password of user:password@host DSNs, with or
+	// without a URL scheme; go-sql-driver/mysql DSNs have none.
+	userinfoPassword = regexp.MustCompile(`^((?:[a-zA-Z][a-zA-Z0-9+.-]*://)?[^:/@]+):(.*)@`)
+	// passwordParam matches password parameters of key=value and query string DSNs,
+	// including single-quoted values with spaces as in password='p w'.
+	passwordParam = regexp.MustCompile(`(?i)\b(password|passwd|pwd)=('(?:[^'\\]|\\.)*'|[^\s&;]*)`)
+)
+
+// RedactDSN returns dsn with its password replaced by "xxxxx", so that it can be
+// shown and logged.
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && strings.Contains(dsn, "://") {
+		dsn = u.Redacted()
+	} else {
+		dsn = userinfoPassword.ReplaceAllString(dsn, "${1}:xxxxx@")
 	}
-	return &cfg, nil
+	return passwordParam.ReplaceAllString(dsn, "${1}=xxxxx")
 }
 
 func guessType(path string) string {
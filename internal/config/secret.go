@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SecretTimeout bounds how long an exec:// helper may take to print a secret.
+var SecretTimeout = 30 * time.Second
+
+// ResolveSecret returns the value a secret reference points to, or ref itself when
+// it is not a reference:
+//
+//	file:///run/secrets/dsn   the content of the file, e.g. a Docker or Kubernetes
+//	                          secret mount, without trailing newlines
+//	env://NAME                the value of environment variable NAME
+//	exec://helper arg...      what the helper prints on stdout, trimmed; it runs
+//	                          without a shell and fails the load with a non-zero exit
+//
+// Load does not resolve file:// DSNs for the sqlite driver, which are SQLite URIs.
+// Errors name the reference but never the secret.
+func ResolveSecret(ctx context.Context, ref string) (string, error) {
+	scheme, rest, ok := strings.Cut(ref, "://")
+	if !ok {
+		return ref, nil
+	}
+	switch scheme {
+	case "file":
+		data, err := os.ReadFile(rest)
+		if err != nil {
+			return "", fmt.Errorf("read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "env":
+		value, ok := os.LookupEnv(rest)
+		if !ok || value == "" {
+			return "", fmt.Errorf("secret environment variable %s is not set", rest)
+		}
+		return value, nil
+	case "exec":
+		args := strings.Fields(rest)
+		if len(args) == 0 {
+			return "", fmt.Errorf("exec:// secret names no command")
+		}
+		ctx, cancel := context.WithTimeout(ctx, SecretTimeout)
+		defer cancel()
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", fmt.Errorf("secret helper %s: %w: %s", args[0], err, msg)
+			}
+			return "", fmt.Errorf("secret helper %s: %w", args[0], err)
+		}
+		value := strings.TrimSpace(stdout.String())
+		if value == "" {
+			return "", fmt.Errorf("secret helper %s printed nothing", args[0])
+		}
+		return value, nil
+	}
+	return ref, nil
+}
+
+// Redact replaces dsn in s, typically an error message, with its redacted form,
+// as well as the password fields of dsn that drivers quote on their own, such as
+// user:password@ and password=... Other occurrences of the password are left
+// alone, so that a short or common password does not mangle the message.
+func Redact(s, dsn string) string {
+	if dsn == "" {
+		return s
+	}
+	s = strings.ReplaceAll(s, dsn, RedactDSN(dsn))
+	passwords := dsnPasswords(dsn)
+	for _, p := range passwords {
+		s = strings.ReplaceAll(s, ":"+p+"@", ":xxxxx@")
+	}
+	return passwordParam.ReplaceAllStringFunc(s, func(field string) string {
+		m := passwordParam.FindStringSubmatch(field)
+		if slices.Contains(passwords, m[2]) {
+			return m[1] + "=xxxxx"
+		}
+		return field
+	})
+}
+
+// dsnPasswords returns the passwords in dsn as written there, quotes included.
+func dsnPasswords(dsn string) []string {
+	var res []string
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if p, ok := u.User.Password(); ok {
+			res = append(res, p)
+		}
+	}
+	if m := userinfoPassword.FindStringSubmatch(dsn); m != nil {
+		res = append(res, m[2])
+	}
+	for _, m := range passwordParam.FindAllStringSubmatch(dsn, -1) {
+		res = append(res, m[2])
+	}
+	nonEmpty := res[:0]
+	for _, p := range res {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return nonEmpty
+}
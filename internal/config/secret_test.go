@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dsn")
+	if err := os.WriteFile(path, []byte("postgres://app:s3cret@db/app\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	t.Setenv("SCIMA_TEST_DSN", "postgres://app:fromenv@db/app")
+	for ref, want := range map[string]string{
+		"postgres://app:plain@db/app": "postgres://app:plain@db/app",
+		"file:app.db":                 "file:app.db",
+		"file://" + path:              "postgres://app:s3cret@db/app",
+		"env://SCIMA_TEST_DSN":        "postgres://app:fromenv@db/app",
+		"exec://echo  helper-dsn ":    "helper-dsn",
+	} {
+		if got, err := ResolveSecret(ctx, ref); err != nil || got != want {
+			t.Errorf("ResolveSecret(%q) = %q, %v; want %q", ref, got, err, want)
+		}
+	}
+	for ref, want := range map[string]string{
+		"file://" + path + ".missing": "read secret file",
+		"env://SCIMA_TEST_UNSET":      "SCIMA_TEST_UNSET is not set",
+		"exec://":                     "names no command",
+		"exec://false":                "secret helper false: exit status 1",
+		"exec://true":                 "printed nothing",
+	} {
+		if _, err := ResolveSecret(ctx, ref); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ResolveSecret(%q): expected error containing %q, got %v", ref, want, err)
+		}
+	}
+
+	if cfg, err := Load(Options{Flags: map[string]string{"dsn": "file://" + path}}); err != nil || cfg.DSN != "postgres://app:s3cret@db/app" {
+		t.Fatalf("dsn not resolved: %+v %v", cfg, err)
+	}
+	if _, list, err := Resolve(Options{Flags: map[string]string{"dsn": "file://" + path}}); err != nil || list[1].Value != "file://"+path {
+		t.Fatalf("Resolve must keep the reference: %+v %v", list, err)
+	}
+	// For sqlite a file:// DSN is a SQLite URI; its secret file goes in DSNFile.
+	uri := "file:///var/db/app.db?cache=shared"
+	if cfg, err := Load(Options{Flags: map[string]string{"driver": "sqlite", "dsn": uri}}); err != nil || cfg.DSN != uri {
+		t.Fatalf("sqlite URI taken for a secret: %+v %v", cfg, err)
+	}
+	if cfg, err := Load(Options{Flags: map[string]string{"driver": "sqlite"}, DSNFile: path}); err != nil || cfg.DSN != "postgres://app:s3cret@db/app" {
+		t.Fatalf("dsn file not read for sqlite: %+v %v", cfg, err)
+	}
+	if _, list, err := Resolve(Options{Flags: map[string]string{"dsn": "postgres://other"}, DSNFile: path}); err != nil || list[1].Value != "file://"+path {
+		t.Fatalf("DSNFile must override the dsn: %+v %v", list, err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	dsn := "postgres://app:pw%zzs3cret@db/app"
+	msg := `parse "postgres://app:pw%zzs3cret@db/app": invalid URL escape "%zz"`
+	if got := Redact(msg, dsn); strings.Contains(got, "s3cret") || !strings.Contains(got, "postgres://app:xxxxx@db/app") {
+		t.Fatalf("unexpected redaction: %s", got)
+	}
+	if got := Redact("dial tcp: refused", ""); got != "dial tcp: refused" {
+		t.Fatalf("unexpected redaction: %s", got)
+	}
+	// A short password only disappears from the DSN's own fields.
+	msg = `pq: password authentication failed for user "a"; conn user=a password=a`
+	if got, want := Redact(msg, "host=db user=a password=a"), `pq: password authentication failed for user "a"; conn user=a password=xxxxx`; got != want {
+		t.Fatalf("Redact = %q, want %q", got, want)
+	}
+	// Quoted key=value passwords are redacted whole.
+	dsn = "host=db user=app password='p w' dbname=db"
+	msg = "cannot parse `" + dsn + "`: bad option; password='p w' dbname"
+	if got := Redact(msg, dsn); strings.Contains(got, "p w") || strings.Contains(got, "w'") {
+		t.Fatalf("quoted password leaked: %s", got)
+	}
+}
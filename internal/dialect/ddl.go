@@ -0,0 +1,284 @@
+package dialect
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DDLDialect is implemented by dialects that can render declarative migrations, so
+// one YAML migration can target several databases.
+type DDLDialect interface {
+	Dialect
+	// RenderOperation returns the statements carrying out op, without terminators.
+	// Raw SQL operations come back as written and may hold several statements.
+	RenderOperation(op Operation) ([]string, error)
+}
+
+// Operation is one step of a declarative migration. Exactly one field is set.
+// Table names may carry a schema prefix or a {{schema?}} placeholder, which index
+// and rename operations carry over to the names they create.
+type Operation struct {
+	CreateTable *CreateTable `yaml:"create_table,omitempty"`
+	DropTable   *DropTable   `yaml:"drop_table,omitempty"`
+	AddColumn   *AddColumn   `yaml:"add_column,omitempty"`
+	DropColumn  *DropColumn  `yaml:"drop_column,omitempty"`
+	CreateIndex *CreateIndex `yaml:"create_index,omitempty"`
+	DropIndex   *DropIndex   `yaml:"drop_index,omitempty"`
+	Rename      *Rename      `yaml:"rename,omitempty"`
+	SQL         *RawSQL      `yaml:"sql,omitempty"`
+}
+
+// Column defines a table column with a portable type, see ColumnTypes.
+type Column struct {
+	Name       string `yaml:"name"`
+	Type       string `yaml:"type"`
+	Length     int    `yaml:"length,omitempty"`    // required for string
+	Precision  int    `yaml:"precision,omitempty"` // optional for decimal, with Scale
+	Scale      int    `yaml:"scale,omitempty"`
+	NotNull    bool   `yaml:"not_null,omitempty"`
+	PrimaryKey bool   `yaml:"primary_key,omitempty"` // implies NotNull
+	Default    string `yaml:"default,omitempty"`     // SQL expression, copied verbatim
+}
+
+// CreateTable creates Table with Columns; primary key columns form one constraint.
+type CreateTable struct {
+	Table   string   `yaml:"table"`
+	Columns []Column `yaml:"columns"`
+}
+
+// DropTable drops Table.
+type DropTable struct {
+	Table string `yaml:"table"`
+}
+
+// AddColumn adds Column to Table.
+type AddColumn struct {
+	Table  string `yaml:"table"`
+	Column Column `yaml:"column"`
+}
+
+// DropColumn drops the column named Column from Table.
+type DropColumn struct {
+	Table  string `yaml:"table"`
+	Column string `yaml:"column"`
+}
+
+// CreateIndex creates index Name on Columns of Table.
+type CreateIndex struct {
+	Name    string   `yaml:"name"`
+	Table   string   `yaml:"table"`
+	Columns []string `yaml:"columns"`
+	Unique  bool     `yaml:"unique,omitempty"`
+}
+
+// DropIndex drops index Name of Table.
+type DropIndex struct {
+	Name  string `yaml:"name"`
+	Table string `yaml:"table"`
+}
+
+// Rename renames Table to To or, if Column is set, that column of Table to To.
+// To is a bare name; a renamed table stays in its schema.
+type Rename struct {
+	Table  string `yaml:"table"`
+	Column string `yaml:"column,omitempty"`
+	To     string `yaml:"to"`
+}
+
+// RawSQL is the escape hatch for what the other operations cannot express. Up holds
+// one or more statements; Down, if set, reverts them. With Dialect set, the operation
+// only runs on that dialect and is skipped on others.
+type RawSQL struct {
+	Up      string `yaml:"up"`
+	Down    string `yaml:"down,omitempty"`
+	Dialect string `yaml:"dialect,omitempty"`
+}
+
+// ColumnTypes lists the portable column types every DDLDialect maps to a native type.
+var ColumnTypes = []string{"integer", "bigint", "smallint", "decimal", "float", "boolean", "string", "text", "date", "timestamp", "blob"}
+
+// ddlSyntax holds the DDL that differs between dialects; render builds the rest.
+// Index formats take the arguments unique ("UNIQUE " or ""), index, qualified index,
+// table, bare table and columns. Formats using only some of their arguments pick
+// them by explicit index, e.g. %[4]s.
+type ddlSyntax struct {
+	types        map[string]string // native type per entry of ColumnTypes
+	createTable  string            // statement keywords, e.g. "CREATE TABLE"
+	addColumn    string            // format: table, column definition
+	dropColumn   string            // format: table, column
+	createIndex  string
+	dropIndex    string
+	renameTable  string // format: table, new name, qualified new name
+	renameColumn string // format: table, column, new name
+}
+
+// render returns the statements for op. Raw SQL is returned as one statement holding
+// everything in Up; the migrator splits it like a migration file.
+func (s ddlSyntax) render(op Operation, dialectName string) ([]string, error) {
+	switch {
+	case op.CreateTable != nil:
+		return s.renderCreateTable(*op.CreateTable)
+	case op.DropTable != nil:
+		return []string{"DROP TABLE " + op.DropTable.Table}, nil
+	case op.AddColumn != nil:
+		def, err := s.columnDefinition(op.AddColumn.Column)
+		if err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf(s.addColumn, op.AddColumn.Table, def)}, nil
+	case op.DropColumn != nil:
+		return []string{fmt.Sprintf(s.dropColumn, op.DropColumn.Table, op.DropColumn.Column)}, nil
+	case op.CreateIndex != nil:
+		ci := op.CreateIndex
+		unique := ""
+		if ci.Unique {
+			unique = "UNIQUE "
+		}
+		q, bare := splitQualifier(ci.Table)
+		return []string{fmt.Sprintf(s.createIndex, unique, ci.Name, q+ci.Name, ci.Table, bare, strings.Join(ci.Columns, ", "))}, nil
+	case op.DropIndex != nil:
+		di := op.DropIndex
+		q, bare := splitQualifier(di.Table)
+		return []string{fmt.Sprintf(s.dropIndex, "", di.Name, q+di.Name, di.Table, bare, "")}, nil
+	case op.Rename != nil:
+		r := op.Rename
+		q, _ := splitQualifier(r.Table)
+		if r.Column != "" {
+			return []string{fmt.Sprintf(s.renameColumn, r.Table, r.Column, r.To)}, nil
+		}
+		return []string{fmt.Sprintf(s.renameTable, r.Table, r.To, q+r.To)}, nil
+	case op.SQL != nil:
+		if op.SQL.Dialect != "" && op.SQL.Dialect != dialectName {
+			return nil, nil
+		}
+		return []string{strings.TrimRight(strings.TrimSpace(op.SQL.Up), ";")}, nil
+	}
+	return nil, fmt.Errorf("empty operation")
+}
+
+func (s ddlSyntax) renderCreateTable(ct CreateTable) ([]string, error) {
+	var defs, pk []string
+	for _, c := range ct.Columns {
+		def, err := s.columnDefinition(c)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+		if c.PrimaryKey {
+			pk = append(pk, c.Name)
+		}
+	}
+	if len(pk) > 0 {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(pk, ", ")))
+	}
+	return []string{fmt.Sprintf("%s %s (\n  %s\n)", s.createTable, ct.Table, strings.Join(defs, ",\n  "))}, nil
+}
+
+// columnDefinition renders c as "name TYPE [DEFAULT expr] [NOT NULL]".
+func (s ddlSyntax) columnDefinition(c Column) (string, error) {
+	native, ok := s.types[c.Type]
+	if !ok {
+		return "", fmt.Errorf("column %s: unknown type %q (use one of %s)", c.Name, c.Type, strings.Join(ColumnTypes, ", "))
+	}
+	switch {
+	case c.Type == "string" && c.Length <= 0:
+		return "", fmt.Errorf("column %s: type string needs a length", c.Name)
+	case c.Type == "string":
+		native = fmt.Sprintf("%s(%d)", native, c.Length)
+	case c.Type == "decimal" && c.Precision > 0:
+		native = fmt.Sprintf("%s(%d,%d)", native, c.Precision, c.Scale)
+	}
+	def := c.Name + " " + native
+	if c.Default != "" {
+		def += " DEFAULT " + c.Default
+	}
+	if c.NotNull || c.PrimaryKey {
+		def += " NOT NULL"
+	}
+	return def, nil
+}
+
+// splitQualifier splits a table name into its schema prefix, such as "app." or a
+// {{schema?}} placeholder, and the bare name.
+func splitQualifier(table string) (qualifier, bare string) {
+	if rest, ok := strings.CutPrefix(table, "{{schema?}}"); ok {
+		return "{{schema?}}", rest
+	}
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		return table[:i+1], table[i+1:]
+	}
+	return "", table
+}
+
+// Validate checks that exactly one field of op is set and that it names what it
+// operates on. Column types are checked when rendering.
+func (op Operation) Validate() error {
+	var kinds []string
+	var missing bool
+	if op.CreateTable != nil {
+		kinds = append(kinds, "create_table")
+		missing = op.CreateTable.Table == "" || len(op.CreateTable.Columns) == 0
+		for _, c := range op.CreateTable.Columns {
+			missing = missing || c.Name == "" || c.Type == ""
+		}
+	}
+	if op.DropTable != nil {
+		kinds = append(kinds, "drop_table")
+		missing = op.DropTable.Table == ""
+	}
+	if op.AddColumn != nil {
+		kinds = append(kinds, "add_column")
+		missing = op.AddColumn.Table == "" || op.AddColumn.Column.Name == "" || op.AddColumn.Column.Type == ""
+	}
+	if op.DropColumn != nil {
+		kinds = append(kinds, "drop_column")
+		missing = op.DropColumn.Table == "" || op.DropColumn.Column == ""
+	}
+	if op.CreateIndex != nil {
+		kinds = append(kinds, "create_index")
+		missing = op.CreateIndex.Name == "" || op.CreateIndex.Table == "" || len(op.CreateIndex.Columns) == 0
+	}
+	if op.DropIndex != nil {
+		kinds = append(kinds, "drop_index")
+		missing = op.DropIndex.Name == "" || op.DropIndex.Table == ""
+	}
+	if op.Rename != nil {
+		kinds = append(kinds, "rename")
+		missing = op.Rename.Table == "" || op.Rename.To == ""
+	}
+	if op.SQL != nil {
+		kinds = append(kinds, "sql")
+		missing = strings.TrimSpace(op.SQL.Up) == ""
+	}
+	switch {
+	case len(kinds) == 0:
+		return fmt.Errorf("empty operation")
+	case len(kinds) > 1:
+		return fmt.Errorf("operation sets %s; use one per list entry", strings.Join(kinds, " and "))
+	case missing:
+		return fmt.Errorf("%s is missing required fields", kinds[0])
+	}
+	return nil
+}
+
+// Inverse returns the operation reverting op, or false if op cannot be reverted
+// because it drops something or is raw SQL without Down.
+func (op Operation) Inverse() (Operation, bool) {
+	switch {
+	case op.CreateTable != nil:
+		return Operation{DropTable: &DropTable{Table: op.CreateTable.Table}}, true
+	case op.AddColumn != nil:
+		return Operation{DropColumn: &DropColumn{Table: op.AddColumn.Table, Column: op.AddColumn.Column.Name}}, true
+	case op.CreateIndex != nil:
+		return Operation{DropIndex: &DropIndex{Name: op.CreateIndex.Name, Table: op.CreateIndex.Table}}, true
+	case op.Rename != nil && op.Rename.Column != "":
+		r := op.Rename
+		return Operation{Rename: &Rename{Table: r.Table, Column: r.To, To: r.Column}}, true
+	case op.Rename != nil:
+		q, bare := splitQualifier(op.Rename.Table)
+		return Operation{Rename: &Rename{Table: q + op.Rename.To, To: bare}}, true
+	case op.SQL != nil && op.SQL.Down != "":
+		return Operation{SQL: &RawSQL{Up: op.SQL.Down, Dialect: op.SQL.Dialect}}, true
+	}
+	return Operation{}, false
+}
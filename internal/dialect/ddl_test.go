@@ -0,0 +1,118 @@
+package dialect
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderOperation(t *testing.T) {
+	ops := []Operation{
+		{CreateTable: &CreateTable{Table: "{{schema?}}users", Columns: []Column{
+			{Name: "id", Type: "bigint", PrimaryKey: true},
+			{Name: "name", Type: "string", Length: 100, NotNull: true, Default: "''"},
+		}}},
+		{AddColumn: &AddColumn{Table: "{{schema?}}users", Column: Column{Name: "balance", Type: "decimal", Precision: 12, Scale: 2}}},
+		{DropColumn: &DropColumn{Table: "{{schema?}}users", Column: "balance"}},
+		{CreateIndex: &CreateIndex{Name: "users_name", Table: "{{schema?}}users", Columns: []string{"name", "id"}, Unique: true}},
+		{DropIndex: &DropIndex{Name: "users_name", Table: "{{schema?}}users"}},
+		{Rename: &Rename{Table: "{{schema?}}users", Column: "name", To: "full_name"}},
+		{Rename: &Rename{Table: "{{schema?}}users", To: "accounts"}},
+		{SQL: &RawSQL{Up: "UPDATE accounts SET id = id;", Dialect: "hana"}},
+	}
+	want := map[string][]string{
+		"postgres": {
+			"CREATE TABLE {{schema?}}users (\n  id BIGINT NOT NULL,\n  name VARCHAR(100) DEFAULT '' NOT NULL,\n  PRIMARY KEY (id)\n)",
+			"ALTER TABLE {{schema?}}users ADD COLUMN balance NUMERIC(12,2)",
+			"ALTER TABLE {{schema?}}users DROP COLUMN balance",
+			"CREATE UNIQUE INDEX users_name ON {{schema?}}users (name, id)",
+			"DROP INDEX {{schema?}}users_name",
+			"ALTER TABLE {{schema?}}users RENAME COLUMN name TO full_name",
+			"ALTER TABLE {{schema?}}users RENAME TO accounts",
+		},
+		"hana": {
+			"CREATE COLUMN TABLE {{schema?}}users (\n  id BIGINT NOT NULL,\n  name NVARCHAR(100) DEFAULT '' NOT NULL,\n  PRIMARY KEY (id)\n)",
+			"ALTER TABLE {{schema?}}users ADD (balance DECIMAL(12,2))",
+			"ALTER TABLE {{schema?}}users DROP (balance)",
+			"CREATE UNIQUE INDEX {{schema?}}users_name ON {{schema?}}users (name, id)",
+			"DROP INDEX {{schema?}}users_name",
+			"RENAME COLUMN {{schema?}}users.name TO full_name",
+			"RENAME TABLE {{schema?}}users TO accounts",
+			"UPDATE accounts SET id = id",
+		},
+		"mysql": {
+			"CREATE TABLE {{schema?}}users (\n  id BIGINT NOT NULL,\n  name VARCHAR(100) DEFAULT '' NOT NULL,\n  PRIMARY KEY (id)\n)",
+			"ALTER TABLE {{schema?}}users ADD COLUMN balance DECIMAL(12,2)",
+			"ALTER TABLE {{schema?}}users DROP COLUMN balance",
+			"CREATE UNIQUE INDEX users_name ON {{schema?}}users (name, id)",
+			"DROP INDEX users_name ON {{schema?}}users",
+			"ALTER TABLE {{schema?}}users RENAME COLUMN name TO full_name",
+			"RENAME TABLE {{schema?}}users TO {{schema?}}accounts",
+		},
+		"sqlite": {
+			"CREATE TABLE {{schema?}}users (\n  id BIGINT NOT NULL,\n  name VARCHAR(100) DEFAULT '' NOT NULL,\n  PRIMARY KEY (id)\n)",
+			"ALTER TABLE {{schema?}}users ADD COLUMN balance NUMERIC(12,2)",
+			"ALTER TABLE {{schema?}}users DROP COLUMN balance",
+			"CREATE UNIQUE INDEX {{schema?}}users_name ON users (name, id)",
+			"DROP INDEX {{schema?}}users_name",
+			"ALTER TABLE {{schema?}}users RENAME COLUMN name TO full_name",
+			"ALTER TABLE {{schema?}}users RENAME TO accounts",
+		},
+	}
+	for name, stmts := range want {
+		d, err := Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dd, ok := d.(DDLDialect)
+		if !ok {
+			t.Fatalf("%s does not implement DDLDialect", name)
+		}
+		var got []string
+		for _, op := range ops {
+			rendered, err := dd.RenderOperation(op)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			got = append(got, rendered...)
+		}
+		if strings.Join(got, "\n;\n") != strings.Join(stmts, "\n;\n") {
+			t.Fatalf("%s rendered:\n%s", name, strings.Join(got, "\n;\n"))
+		}
+	}
+	if _, err := (PostgresDialect{}).RenderOperation(Operation{AddColumn: &AddColumn{Table: "t", Column: Column{Name: "c", Type: "string"}}}); err == nil || !strings.Contains(err.Error(), "needs a length") {
+		t.Fatalf("expected length error, got %v", err)
+	}
+	if _, err := (HanaDialect{}).RenderOperation(Operation{AddColumn: &AddColumn{Table: "t", Column: Column{Name: "c", Type: "jsonb"}}}); err == nil || !strings.Contains(err.Error(), `unknown type "jsonb"`) {
+		t.Fatalf("expected type error, got %v", err)
+	}
+}
+
+func TestOperationValidateAndInverse(t *testing.T) {
+	if err := (Operation{}).Validate(); err == nil {
+		t.Fatalf("expected error for empty operation")
+	}
+	both := Operation{DropTable: &DropTable{Table: "t"}, SQL: &RawSQL{Up: "SELECT 1"}}
+	if err := both.Validate(); err == nil || !strings.Contains(err.Error(), "drop_table and sql") {
+		t.Fatalf("expected error for two kinds, got %v", err)
+	}
+	if err := (Operation{CreateIndex: &CreateIndex{Name: "i", Table: "t"}}).Validate(); err == nil {
+		t.Fatalf("expected error for index without columns")
+	}
+	inv, ok := Operation{Rename: &Rename{Table: "app.users", To: "accounts"}}.Inverse()
+	if !ok || *inv.Rename != (Rename{Table: "app.accounts", To: "users"}) {
+		t.Fatalf("unexpected inverse: %+v", inv.Rename)
+	}
+	inv, ok = Operation{Rename: &Rename{Table: "users", Column: "a", To: "b"}}.Inverse()
+	if !ok || *inv.Rename != (Rename{Table: "users", Column: "b", To: "a"}) {
+		t.Fatalf("unexpected column inverse: %+v", inv.Rename)
+	}
+	for _, op := range []Operation{
+		{DropTable: &DropTable{Table: "t"}},
+		{DropColumn: &DropColumn{Table: "t", Column: "c"}},
+		{SQL: &RawSQL{Up: "DELETE FROM t"}},
+	} {
+		if _, ok := op.Inverse(); ok {
+			t.Fatalf("%+v should not be reversible", op)
+		}
+	}
+}
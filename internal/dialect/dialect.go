@@ -3,21 +3,43 @@ package dialect
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 )
 
 const (
 	migrationTable = "SCIMA_SCHEMA_MIGRATIONS"
+	lockTable      = "SCIMA_SCHEMA_LOCK"
 )
 
+// lockPollInterval is the delay between attempts while waiting for a migration lock.
+var lockPollInterval = 500 * time.Millisecond
+
 // Conn abstracts minimal operations needed for migration execution.
 // Each dialect can wrap a DB connection or tx.
-// Exec should execute statements separated already (no multi-statement parsing here).
+// Exec receives one statement at a time; the migrator splits files beforehand.
 type Conn interface {
 	ExecContext(ctx context.Context, query string, args ...any) (Result, error)
 	QueryContext(ctx context.Context, query string, args ...any) (Rows, error)
 }
 
+// Tx is a Conn bound to an open transaction.
+type Tx interface {
+	Conn
+	Commit() error
+	Rollback() error
+}
+
+// TxConn is a Conn that can begin transactions.
+type TxConn interface {
+	Conn
+	BeginTx(ctx context.Context) (Tx, error)
+}
+
 // Result abstracts the result of a database operation.
 type Result interface {
 	RowsAffected() (int64, error)
@@ -34,10 +56,175 @@ type Rows interface {
 // Dialect binds SQL variants and introspection / DDL helpers.
 type Dialect interface {
 	Name() string
+	// SupportsTransactionalDDL reports whether DDL can be rolled back, so a migration
+	// and its bookkeeping row can run in one transaction.
+	SupportsTransactionalDDL() bool
+	// CheckStatement rejects a migration statement the dialect knows will not work
+	// as written, e.g. one that has no effect inside a transaction (inTx).
+	CheckStatement(stmt string, inTx bool) error
 	EnsureMigrationTable(ctx context.Context, c Conn, schema string) error
-	SelectAppliedVersions(ctx context.Context, c Conn, schema string) (map[int64]bool, error)
-	InsertVersion(ctx context.Context, c Conn, schema string, version int64) error
+	// MigrationTableExists reports whether the tracking table exists, without
+	// creating or changing it.
+	MigrationTableExists(ctx context.Context, c Conn, schema string) (bool, error)
+	// SelectApplied returns the tracking table rows ordered by version.
+	SelectApplied(ctx context.Context, c Conn, schema string) ([]AppliedMigration, error)
+	// InsertVersion records an applied migration. DBUser is filled in by the database.
+	InsertVersion(ctx context.Context, c Conn, schema string, m AppliedMigration) error
+	// UpdateVersion overwrites the row for m.Version, e.g. to clear or set the dirty flag.
+	UpdateVersion(ctx context.Context, c Conn, schema string, m AppliedMigration) error
 	DeleteVersion(ctx context.Context, c Conn, schema string, version int64) error
+	// Lock acquires the migration lock for schema, waiting at most timeout.
+	// Session scoped locks require c to stay on one database session until Unlock.
+	Lock(ctx context.Context, c Conn, schema string, timeout time.Duration) error
+	// Unlock releases a lock acquired with Lock.
+	Unlock(ctx context.Context, c Conn, schema string) error
+	// ForceUnlock clears a lock left behind by a process that died while holding it.
+	ForceUnlock(ctx context.Context, c Conn, schema string) error
+	// DescribeError extracts driver specific diagnostics from a statement error.
+	DescribeError(err error) ErrorDetails
+}
+
+// ErrorDetails holds driver specific diagnostics for a failed statement.
+// Zero fields mean the driver did not report them.
+type ErrorDetails struct {
+	Code     string `json:"code,omitempty"`     // SQLSTATE (Postgres) or SQL error code (HANA)
+	Position int    `json:"position,omitempty"` // 1-based character offset of the error in the statement
+	Line     int    `json:"line,omitempty"`     // 1-based line in the statement, for drivers reporting no Position
+	Hint     string `json:"hint,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// AppliedMigration is one row of the migration tracking table.
+// Rows written before a column existed leave the matching field zero.
+type AppliedMigration struct {
+	Version      int64         `json:"version"`
+	Name         string        `json:"name"`
+	Checksum     string        `json:"checksum"`
+	AppliedAt    time.Time     `json:"applied_at"`
+	Duration     time.Duration `json:"duration_ns"`
+	AppliedBy    string        `json:"applied_by"` // OS user running scima
+	DBUser       string        `json:"db_user"`
+	Hostname     string        `json:"hostname"`
+	ScimaVersion string        `json:"scima_version"`
+	// Dirty marks a migration that started but did not finish; Error holds the cause.
+	Dirty bool   `json:"dirty"`
+	Error string `json:"error,omitempty"`
+	// OutOfOrder marks a migration applied after a higher version had already run.
+	OutOfOrder bool `json:"out_of_order,omitempty"`
+}
+
+// Repeatable reports whether the row tracks a repeatable migration, which the
+// migrate package records under a negative version.
+func (m AppliedMigration) Repeatable() bool { return m.Version < 0 }
+
+// appliedColumns lists the tracking table columns in the order scanApplied expects.
+const appliedColumns = "version, name, checksum, applied_at, execution_ms, applied_by, db_user, hostname, scima_version, dirty, last_error, out_of_order"
+
+// updateColumns are the columns UpdateVersion may change, in the order of updateArgs.
+var updateColumns = []string{"name", "checksum", "applied_at", "execution_ms", "applied_by", "hostname", "scima_version", "dirty", "last_error", "out_of_order"}
+
+// updateStatement builds the UpdateVersion statement; bind renders the n-th (1-based) placeholder.
+func updateStatement(table string, bind func(n int) string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "UPDATE %s SET ", table)
+	for i, col := range updateColumns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%s = %s", col, bind(i+1))
+	}
+	fmt.Fprintf(&sb, " WHERE version = %s", bind(len(updateColumns)+1))
+	return sb.String()
+}
+
+// updateArgs returns the bind values for updateStatement.
+func updateArgs(m AppliedMigration) []any {
+	return []any{m.Name, m.Checksum, m.AppliedAt, m.Duration.Milliseconds(), m.AppliedBy, m.Hostname, m.ScimaVersion, m.Dirty, m.Error, m.OutOfOrder, m.Version}
+}
+
+// nullTime scans timestamps from drivers returning time.Time as well as from those
+// returning text, such as MySQL without parseTime=true in the DSN.
+type nullTime struct{ Time time.Time }
+
+// Scan implements sql.Scanner.
+func (t *nullTime) Scan(v any) error {
+	switch x := v.(type) {
+	case nil:
+		t.Time = time.Time{}
+	case time.Time:
+		t.Time = x
+	case []byte:
+		return t.parse(string(x))
+	case string:
+		return t.parse(x)
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", v)
+	}
+	return nil
+}
+
+func (t *nullTime) parse(s string) error {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano} {
+		if ts, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			t.Time = ts
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot parse timestamp %q", s)
+}
+
+// countRows runs a query selecting a single count.
+func countRows(ctx context.Context, c Conn, query string, args ...any) (int64, error) {
+	rows, err := c.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "warning: error closing rows: %v\n", cerr)
+		}
+	}()
+	var n int64
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return 0, err
+		}
+	}
+	return n, rows.Err()
+}
+
+// scanApplied reads rows selected with appliedColumns.
+func scanApplied(rows Rows) ([]AppliedMigration, error) {
+	var res []AppliedMigration
+	for rows.Next() {
+		var (
+			m                                         AppliedMigration
+			name, sum, by, dbUser, host, scimaVersion sql.NullString
+			lastErr                                   sql.NullString
+			appliedAt                                 nullTime
+			execMS                                    sql.NullInt64
+			dirty, outOfOrder                         sql.NullBool
+		)
+		if err := rows.Scan(&m.Version, &name, &sum, &appliedAt, &execMS, &by, &dbUser, &host, &scimaVersion, &dirty, &lastErr, &outOfOrder); err != nil {
+			return nil, err
+		}
+		m.Name = name.String
+		m.Checksum = sum.String
+		m.AppliedAt = appliedAt.Time
+		m.Duration = time.Duration(execMS.Int64) * time.Millisecond
+		m.AppliedBy = by.String
+		m.DBUser = dbUser.String
+		m.Hostname = host.String
+		m.ScimaVersion = scimaVersion.String
+		m.Dirty = dirty.Bool
+		m.Error = lastErr.String
+		m.OutOfOrder = outOfOrder.Bool
+		res = append(res, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 var registry = map[string]Dialect{}
@@ -55,8 +242,46 @@ func Get(name string) (Dialect, error) {
 }
 
 func qualifiedMigrationTable(schema string) string {
+	return qualifiedTable(schema, migrationTable)
+}
+
+func qualifiedTable(schema, table string) string {
 	if schema == "" {
-		return migrationTable
+		return table
+	}
+	return fmt.Sprintf("\"%s\".%s", schema, table)
+}
+
+// ErrLockTimeout is returned when the migration lock could not be acquired in time.
+var ErrLockTimeout = errors.New("timed out waiting for migration lock")
+
+// pollLock calls try until it acquires the lock, fails, or timeout elapses.
+func pollLock(ctx context.Context, timeout time.Duration, try func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("%w after %s", ErrLockTimeout, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// lockOwner identifies this process in lock tables.
+func lockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
 	}
-	return fmt.Sprintf("\"%s\".%s", schema, migrationTable)
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
 }
@@ -1,9 +1,44 @@
 package dialect
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
 
 func TestRegistryUnknown(t *testing.T) {
 	if _, err := Get("doesnotexist"); err == nil {
 		t.Fatalf("expected error for unknown dialect")
 	}
 }
+
+// recordConn records statements and fails queries whose text contains failOn.
+// Statements other than CREATE fail with execErr when it is set.
+type recordConn struct {
+	execs   []string
+	failOn  string
+	execErr error
+}
+
+func (r *recordConn) ExecContext(_ context.Context, query string, _ ...any) (Result, error) {
+	r.execs = append(r.execs, query)
+	if r.execErr != nil && !strings.HasPrefix(query, "CREATE") {
+		return nil, r.execErr
+	}
+	return nil, nil
+}
+
+func (r *recordConn) QueryContext(_ context.Context, query string, _ ...any) (Rows, error) {
+	if r.failOn != "" && strings.Contains(query, r.failOn) {
+		return nil, errors.New("invalid column name")
+	}
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Next() bool        { return false }
+func (emptyRows) Scan(...any) error { return nil }
+func (emptyRows) Close() error      { return nil }
+func (emptyRows) Err() error        { return nil }
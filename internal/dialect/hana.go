@@ -2,8 +2,12 @@ package dialect
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // HanaDialect implements Dialect for SAP HANA.
@@ -12,8 +16,29 @@ type HanaDialect struct{}
 // Name returns the name of the dialect ("hana").
 func (h HanaDialect) Name() string { return "hana" }
 
+// SupportsTransactionalDDL returns false; HANA commits DDL implicitly.
+func (h HanaDialect) SupportsTransactionalDDL() bool { return false }
+
+// CheckStatement accepts every statement.
+func (HanaDialect) CheckStatement(string, bool) error { return nil }
+
 func init() { Register(HanaDialect{}) }
 
+// hanaTrackingColumns are added to tables created by older scima versions.
+var hanaTrackingColumns = []struct{ name, colType string }{
+	{"checksum", "NVARCHAR(64)"},
+	{"name", "NVARCHAR(255)"},
+	{"applied_at", "TIMESTAMP"},
+	{"execution_ms", "BIGINT"},
+	{"applied_by", "NVARCHAR(255)"},
+	{"db_user", "NVARCHAR(255)"},
+	{"hostname", "NVARCHAR(255)"},
+	{"scima_version", "NVARCHAR(64)"},
+	{"dirty", "BOOLEAN"},
+	{"last_error", "NVARCHAR(5000)"},
+	{"out_of_order", "BOOLEAN"},
+}
+
 // EnsureMigrationTable creates the migration tracking table if it does not exist.
 func (h HanaDialect) EnsureMigrationTable(ctx context.Context, c Conn, schema string) error {
 	// Try create table if not exists. HANA before 2.0 lacks standard IF NOT EXISTS for some DDL; we attempt and ignore errors.
@@ -33,6 +58,32 @@ func (h HanaDialect) EnsureMigrationTable(ctx context.Context, c Conn, schema st
 			}
 		}
 	}
+	// Upgrade tables created before these columns were tracked.
+	for _, col := range hanaTrackingColumns {
+		if err := h.ensureColumn(ctx, c, table, col.name, col.colType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrationTableExists looks the tracking table up in SYS.TABLES.
+func (h HanaDialect) MigrationTableExists(ctx context.Context, c Conn, schema string) (bool, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM SYS.TABLES WHERE SCHEMA_NAME = %s AND TABLE_NAME = '%s'", hanaSchemaLiteral(schema), migrationTable)
+	n, err := countRows(ctx, c, query)
+	return n > 0, err
+}
+
+// ensureColumn adds column to table unless a probe query shows it already exists.
+// HANA has no ADD COLUMN IF NOT EXISTS, so the probe keeps the upgrade idempotent.
+func (h HanaDialect) ensureColumn(ctx context.Context, c Conn, table, column, colType string) error {
+	rows, err := c.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE 1=0", column, table))
+	if err == nil {
+		return rows.Close()
+	}
+	if _, aerr := c.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD (%s %s)", table, column, colType)); aerr != nil {
+		return fmt.Errorf("add column %s to %s failed: %v probeErr: %v", column, table, aerr, err)
+	}
 	return nil
 }
 
@@ -68,40 +119,42 @@ func stringIndexFold(hay, needle string) int {
 	return -1
 }
 
-// SelectAppliedVersions returns a map of applied migration versions from the tracking table.
-func (h HanaDialect) SelectAppliedVersions(ctx context.Context, c Conn, schema string) (map[int64]bool, error) {
+// SelectApplied returns the tracking table rows ordered by version.
+func (h HanaDialect) SelectApplied(ctx context.Context, c Conn, schema string) ([]AppliedMigration, error) {
 	table := qualifiedMigrationTable(schema)
-	rows, err := c.QueryContext(ctx, fmt.Sprintf("SELECT version FROM %s", table))
+	query := fmt.Sprintf("SELECT %s FROM %s ORDER BY version", appliedColumns, table)
+	rows, err := c.QueryContext(ctx, query)
 	if err != nil {
-		// If table not existing treat as empty; attempt create then return empty.
+		// The table may not exist yet; create it and retry. Once it exists a failing
+		// select is a real error, not an empty history.
 		if cerr := h.EnsureMigrationTable(ctx, c, schema); cerr != nil {
 			return nil, err
 		}
-		return map[int64]bool{}, nil
+		if rows, err = c.QueryContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("select applied migrations: %w", err)
+		}
 	}
 	defer func() {
 		if cerr := rows.Close(); cerr != nil {
-			fmt.Fprintf(os.Stderr, "error closing db: %v\n", err)
+			fmt.Fprintf(os.Stderr, "error closing rows: %v\n", cerr)
 		}
 	}()
-	applied := map[int64]bool{}
-	for rows.Next() {
-		var v int64
-		if err := rows.Scan(&v); err != nil {
-			return nil, err
-		}
-		applied[v] = true
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return applied, nil
+	return scanApplied(rows)
 }
 
-// InsertVersion inserts a migration version into the HANA migrations table.
-func (h HanaDialect) InsertVersion(ctx context.Context, c Conn, schema string, version int64) error {
+// InsertVersion records an applied migration in the HANA migrations table.
+func (h HanaDialect) InsertVersion(ctx context.Context, c Conn, schema string, m AppliedMigration) error {
 	table := qualifiedMigrationTable(schema)
-	_, err := c.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", table), version)
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?, ?, ?, ?, ?, ?, CURRENT_USER, ?, ?, ?, ?, ?)", table, appliedColumns)
+	_, err := c.ExecContext(ctx, stmt, m.Version, m.Name, m.Checksum, m.AppliedAt, m.Duration.Milliseconds(), m.AppliedBy, m.Hostname, m.ScimaVersion, m.Dirty, m.Error, m.OutOfOrder)
+	return err
+}
+
+// UpdateVersion overwrites the HANA tracking row for m.Version.
+func (h HanaDialect) UpdateVersion(ctx context.Context, c Conn, schema string, m AppliedMigration) error {
+	table := qualifiedMigrationTable(schema)
+	stmt := updateStatement(table, func(int) string { return "?" })
+	_, err := c.ExecContext(ctx, stmt, updateArgs(m)...)
 	return err
 }
 
@@ -111,3 +164,166 @@ func (h HanaDialect) DeleteVersion(ctx context.Context, c Conn, schema string, v
 	_, err := c.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = ?", table), version)
 	return err
 }
+
+// Lock inserts the single row of the lock table, retrying while another process holds it.
+// A row is used rather than LOCK TABLE ... IN EXCLUSIVE MODE because HANA commits DDL
+// implicitly, which would release a table lock as soon as the first migration ran.
+func (h HanaDialect) Lock(ctx context.Context, c Conn, schema string, timeout time.Duration) error {
+	table := qualifiedTable(schema, lockTable)
+	if err := h.ensureLockTable(ctx, c, table); err != nil {
+		return err
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (id, locked_at, locked_by) VALUES (1, CURRENT_UTCTIMESTAMP, ?)", table)
+	return pollLock(ctx, timeout, func() (bool, error) {
+		_, err := c.ExecContext(ctx, insert, lockOwner())
+		if err == nil {
+			return true, nil
+		}
+		if hanaErrorCode(err) == hanaUniqueViolation {
+			return false, nil
+		}
+		return false, err
+	})
+}
+
+// HANA error codes scima reacts to.
+const (
+	hanaDuplicateTable  = 288 // cannot use duplicate table name
+	hanaUniqueViolation = 301 // unique constraint violated
+)
+
+// hanaErrorCode returns the HANA error code of err, or 0 if the driver reported none.
+func hanaErrorCode(err error) int {
+	var he hdbError
+	if !errors.As(err, &he) {
+		return 0
+	}
+	return he.Code()
+}
+
+// ensureLockTable creates the lock table unless a probe query shows it exists. A
+// concurrent run creating it first makes CREATE fail with a duplicate table error.
+func (h HanaDialect) ensureLockTable(ctx context.Context, c Conn, table string) error {
+	rows, err := c.QueryContext(ctx, fmt.Sprintf("SELECT id FROM %s WHERE 1=0", table))
+	if err == nil {
+		return rows.Close()
+	}
+	create := fmt.Sprintf("CREATE TABLE %s (id INT PRIMARY KEY, locked_at TIMESTAMP, locked_by NVARCHAR(255))", table)
+	if _, cerr := c.ExecContext(ctx, create); cerr != nil && hanaErrorCode(cerr) != hanaDuplicateTable {
+		return fmt.Errorf("ensure lock table failed: %v probeErr: %v", cerr, err)
+	}
+	return nil
+}
+
+// Unlock deletes the lock row if this process owns it.
+func (h HanaDialect) Unlock(ctx context.Context, c Conn, schema string) error {
+	table := qualifiedTable(schema, lockTable)
+	_, err := c.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = 1 AND locked_by = ?", table), lockOwner())
+	return err
+}
+
+// ForceUnlock deletes the lock row regardless of its owner.
+func (h HanaDialect) ForceUnlock(ctx context.Context, c Conn, schema string) error {
+	table := qualifiedTable(schema, lockTable)
+	_, err := c.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = 1", table))
+	return err
+}
+
+// hanaSchemaLiteral returns the SQL expression for the schema holding the tracking
+// table, as stored in the SYS views.
+func hanaSchemaLiteral(schema string) string {
+	if schema == "" {
+		return "CURRENT_SCHEMA"
+	}
+	return sqlString(schema)
+}
+
+// ScriptPrologue renders an anonymous block creating the tracking table and adding
+// missing columns, probing SYS.TABLES and SYS.TABLE_COLUMNS first.
+func (h HanaDialect) ScriptPrologue(schema string) string {
+	table := qualifiedMigrationTable(schema)
+	owner := hanaSchemaLiteral(schema)
+	var sb strings.Builder
+	sb.WriteString("DO BEGIN\n  DECLARE n INTEGER;\n")
+	fmt.Fprintf(&sb, "  SELECT COUNT(*) INTO n FROM SYS.TABLES WHERE SCHEMA_NAME = %s AND TABLE_NAME = '%s';\n", owner, migrationTable)
+	fmt.Fprintf(&sb, "  IF :n = 0 THEN\n    EXEC %s;\n  END IF;\n", sqlString(fmt.Sprintf("CREATE TABLE %s (version BIGINT PRIMARY KEY)", table)))
+	for _, col := range hanaTrackingColumns {
+		fmt.Fprintf(&sb, "  SELECT COUNT(*) INTO n FROM SYS.TABLE_COLUMNS WHERE SCHEMA_NAME = %s AND TABLE_NAME = '%s' AND COLUMN_NAME = '%s';\n", owner, migrationTable, strings.ToUpper(col.name))
+		fmt.Fprintf(&sb, "  IF :n = 0 THEN\n    EXEC %s;\n  END IF;\n", sqlString(fmt.Sprintf("ALTER TABLE %s ADD (%s %s)", table, col.name, col.colType)))
+	}
+	sb.WriteString("END;\n")
+	return sb.String()
+}
+
+// ScriptUp renders an anonymous block running the statements through EXEC unless the
+// version is recorded. HANA commits DDL implicitly, so a failing statement leaves
+// the earlier ones applied, as with a live run.
+func (h HanaDialect) ScriptUp(schema string, m AppliedMigration, stmts []string) string {
+	table := qualifiedMigrationTable(schema)
+	insert := insertVersionSQL(table, m, sqlString, "CURRENT_UTCTIMESTAMP", "CURRENT_USER")
+	return hanaGuard(table, m.Version, "=", stmts, insert)
+}
+
+// ScriptDown renders an anonymous block running the statements through EXEC if the
+// version is recorded.
+func (h HanaDialect) ScriptDown(schema string, version int64, stmts []string) string {
+	table := qualifiedMigrationTable(schema)
+	return hanaGuard(table, version, ">", stmts, fmt.Sprintf("DELETE FROM %s WHERE version = %d", table, version))
+}
+
+// hanaGuard renders a block that counts the rows of version and runs stmts followed
+// by bookkeeping if the count compares to zero with op.
+func hanaGuard(table string, version int64, op string, stmts []string, bookkeeping string) string {
+	var sb strings.Builder
+	sb.WriteString("DO BEGIN\n  DECLARE n INTEGER;\n")
+	fmt.Fprintf(&sb, "  SELECT COUNT(*) INTO n FROM %s WHERE version = %d;\n", table, version)
+	fmt.Fprintf(&sb, "  IF :n %s 0 THEN\n", op)
+	for _, stmt := range stmts {
+		fmt.Fprintf(&sb, "    EXEC %s;\n", sqlString(stmt))
+	}
+	fmt.Fprintf(&sb, "    %s;\n  END IF;\nEND;\n", bookkeeping)
+	return sb.String()
+}
+
+// hdbError matches the error interface of the go-hdb driver without importing it.
+type hdbError interface {
+	error
+	Code() int
+	Position() int
+}
+
+// DescribeError returns the SQL error code and position reported by the HANA driver.
+func (h HanaDialect) DescribeError(err error) ErrorDetails {
+	var he hdbError
+	if !errors.As(err, &he) {
+		return ErrorDetails{}
+	}
+	d := ErrorDetails{Code: strconv.Itoa(he.Code())}
+	if he.Position() > 0 {
+		// HANA reports a 0-based position.
+		d.Position = he.Position() + 1
+	}
+	return d
+}
+
+// hanaDDL renders declarative migrations for HANA, which stores strings as Unicode
+// NVARCHAR and creates column tables.
+var hanaDDL = ddlSyntax{
+	types: map[string]string{
+		"integer": "INTEGER", "bigint": "BIGINT", "smallint": "SMALLINT", "decimal": "DECIMAL",
+		"float": "DOUBLE", "boolean": "BOOLEAN", "string": "NVARCHAR", "text": "NCLOB",
+		"date": "DATE", "timestamp": "TIMESTAMP", "blob": "BLOB",
+	},
+	createTable:  "CREATE COLUMN TABLE",
+	addColumn:    "ALTER TABLE %s ADD (%s)",
+	dropColumn:   "ALTER TABLE %s DROP (%s)",
+	createIndex:  "CREATE %[1]sINDEX %[3]s ON %[4]s (%[6]s)",
+	dropIndex:    "DROP INDEX %[3]s",
+	renameTable:  "RENAME TABLE %[1]s TO %[2]s",
+	renameColumn: "RENAME COLUMN %s.%s TO %s",
+}
+
+// RenderOperation implements DDLDialect.
+func (h HanaDialect) RenderOperation(op Operation) ([]string, error) {
+	return hanaDDL.render(op, h.Name())
+}
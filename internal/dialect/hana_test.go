@@ -1,6 +1,13 @@
 package dialect
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestHanaRegistered(t *testing.T) {
 	d, err := Get("hana")
@@ -11,3 +18,126 @@ func TestHanaRegistered(t *testing.T) {
 		t.Fatalf("unexpected name: %s", d.Name())
 	}
 }
+
+func TestHanaEnsureMigrationTableAddsChecksumColumn(t *testing.T) {
+	c := &recordConn{failOn: "SELECT checksum"}
+	if err := (HanaDialect{}).EnsureMigrationTable(context.Background(), c, "S"); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	last := c.execs[len(c.execs)-1]
+	if last != `ALTER TABLE "S".SCIMA_SCHEMA_MIGRATIONS ADD (checksum NVARCHAR(64))` {
+		t.Fatalf("expected checksum upgrade, got %q", last)
+	}
+	c = &recordConn{}
+	if err := (HanaDialect{}).EnsureMigrationTable(context.Background(), c, "S"); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	for _, e := range c.execs {
+		if strings.HasPrefix(e, "ALTER") {
+			t.Fatalf("unexpected upgrade when column exists: %q", e)
+		}
+	}
+}
+
+func TestHanaSelectAppliedReturnsErrors(t *testing.T) {
+	c := &recordConn{failOn: "ORDER BY version"}
+	if rows, err := (HanaDialect{}).SelectApplied(context.Background(), c, ""); err == nil {
+		t.Fatalf("expected select error, got history %v", rows)
+	}
+	if _, err := (HanaDialect{}).SelectApplied(context.Background(), &recordConn{}, ""); err != nil {
+		t.Fatalf("select: %v", err)
+	}
+}
+
+func TestHanaLockTimesOutWhileHeld(t *testing.T) {
+	old := lockPollInterval
+	lockPollInterval = time.Millisecond
+	defer func() { lockPollInterval = old }()
+	c := &recordConn{execErr: fakeHdbError{code: hanaUniqueViolation}}
+	err := (HanaDialect{}).Lock(context.Background(), c, "", 5*time.Millisecond)
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected lock timeout, got %v", err)
+	}
+	c = &recordConn{}
+	if err := (HanaDialect{}).Lock(context.Background(), c, "", 0); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if !strings.HasPrefix(c.execs[len(c.execs)-1], "INSERT INTO SCIMA_SCHEMA_LOCK") {
+		t.Fatalf("lock row not inserted: %v", c.execs)
+	}
+}
+
+type fakeHdbError struct{ code, pos int }
+
+func (e fakeHdbError) Error() string { return "sql syntax error" }
+func (e fakeHdbError) Code() int     { return e.code }
+func (e fakeHdbError) Position() int { return e.pos }
+
+// hanaLockConn behaves like a HANA database holding the lock table: CREATE fails
+// with a duplicate table error once it exists, and INSERT with a unique violation
+// while the lock row is present.
+type hanaLockConn struct {
+	tableExists, held bool
+	creates           int
+}
+
+func (c *hanaLockConn) ExecContext(_ context.Context, query string, _ ...any) (Result, error) {
+	switch {
+	case strings.HasPrefix(query, "CREATE"):
+		c.creates++
+		if c.tableExists {
+			return nil, fakeHdbError{code: hanaDuplicateTable}
+		}
+		c.tableExists = true
+	case strings.HasPrefix(query, "INSERT"):
+		if c.held {
+			return nil, fakeHdbError{code: hanaUniqueViolation}
+		}
+		c.held = true
+	case strings.HasPrefix(query, "DELETE"):
+		c.held = false
+	}
+	return nil, nil
+}
+
+func (c *hanaLockConn) QueryContext(context.Context, string, ...any) (Rows, error) {
+	if !c.tableExists {
+		return nil, fakeHdbError{code: 259} // invalid table name
+	}
+	return emptyRows{}, nil
+}
+
+func TestHanaLockWithExistingTable(t *testing.T) {
+	ctx := context.Background()
+	c := &hanaLockConn{}
+	for i := 0; i < 2; i++ {
+		if err := (HanaDialect{}).Lock(ctx, c, "", 0); err != nil {
+			t.Fatalf("lock %d: %v", i+1, err)
+		}
+		if err := (HanaDialect{}).Unlock(ctx, c, ""); err != nil {
+			t.Fatalf("unlock %d: %v", i+1, err)
+		}
+	}
+	if c.creates != 1 {
+		t.Fatalf("expected the lock table to be created once, got %d CREATEs", c.creates)
+	}
+	// A concurrent run may create the table between the probe and CREATE.
+	c = &hanaLockConn{tableExists: true}
+	if err := (HanaDialect{}).ensureLockTable(ctx, &racingConn{c}, "SCIMA_SCHEMA_LOCK"); err != nil {
+		t.Fatalf("duplicate table error not tolerated: %v", err)
+	}
+}
+
+// racingConn fails the probe query although the table exists.
+type racingConn struct{ *hanaLockConn }
+
+func (racingConn) QueryContext(context.Context, string, ...any) (Rows, error) {
+	return nil, fakeHdbError{code: 259}
+}
+
+func TestHanaDescribeError(t *testing.T) {
+	got := (HanaDialect{}).DescribeError(fmt.Errorf("exec: %w", fakeHdbError{code: 257, pos: 16}))
+	if got.Code != "257" || got.Position != 17 {
+		t.Fatalf("unexpected details: %+v", got)
+	}
+}
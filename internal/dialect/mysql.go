@@ -0,0 +1,301 @@
+package dialect
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQLDialect implements Dialect for MySQL and MariaDB.
+type MySQLDialect struct{}
+
+// Name returns the name of the dialect ("mysql").
+func (d MySQLDialect) Name() string { return "mysql" }
+
+func init() { Register(MySQLDialect{}) }
+
+// SupportsTransactionalDDL returns false; MySQL commits implicitly before and after
+// most DDL statements, so wrapping a migration in a transaction would not make it atomic.
+func (d MySQLDialect) SupportsTransactionalDDL() bool { return false }
+
+// CheckStatement accepts every statement.
+func (MySQLDialect) CheckStatement(string, bool) error { return nil }
+
+// mysqlTrackingColumns are added to tables created by older scima versions.
+var mysqlTrackingColumns = []struct{ name, colType string }{
+	{"checksum", "VARCHAR(64)"},
+	{"name", "VARCHAR(255)"},
+	{"applied_at", "DATETIME(6)"},
+	{"execution_ms", "BIGINT"},
+	{"applied_by", "VARCHAR(255)"},
+	{"db_user", "VARCHAR(255)"},
+	{"hostname", "VARCHAR(255)"},
+	{"scima_version", "VARCHAR(64)"},
+	{"dirty", "BOOLEAN"},
+	{"last_error", "TEXT"},
+	{"out_of_order", "BOOLEAN"},
+}
+
+// mysqlTable quotes a table name with backticks, qualified by schema (a MySQL database) when set.
+func mysqlTable(schema, table string) string {
+	if schema == "" {
+		return "`" + table + "`"
+	}
+	return fmt.Sprintf("`%s`.`%s`", schema, table)
+}
+
+// EnsureMigrationTable creates the migration tracking table if it does not exist.
+func (d MySQLDialect) EnsureMigrationTable(ctx context.Context, c Conn, schema string) error {
+	table := mysqlTable(schema, migrationTable)
+	if _, err := c.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY)", table)); err != nil {
+		return err
+	}
+	// MySQL lacks ADD COLUMN IF NOT EXISTS, so look the existing columns up first.
+	existing, err := d.columns(ctx, c, schema)
+	if err != nil {
+		return err
+	}
+	for _, col := range mysqlTrackingColumns {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := c.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.name, col.colType)); err != nil {
+			return fmt.Errorf("add column %s to %s failed: %w", col.name, table, err)
+		}
+	}
+	return nil
+}
+
+// MigrationTableExists reports whether information_schema lists columns of the tracking table.
+func (d MySQLDialect) MigrationTableExists(ctx context.Context, c Conn, schema string) (bool, error) {
+	cols, err := d.columns(ctx, c, schema)
+	return len(cols) > 0, err
+}
+
+// columns returns the lower-cased column names of the tracking table.
+func (d MySQLDialect) columns(ctx context.Context, c Conn, schema string) (map[string]bool, error) {
+	query := "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?"
+	rows, err := c.QueryContext(ctx, query, schema, migrationTable)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "warning: error closing rows: %v\n", cerr)
+		}
+	}()
+	res := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		res[strings.ToLower(name)] = true
+	}
+	return res, rows.Err()
+}
+
+// SelectApplied returns the tracking table rows ordered by version.
+func (d MySQLDialect) SelectApplied(ctx context.Context, c Conn, schema string) ([]AppliedMigration, error) {
+	table := mysqlTable(schema, migrationTable)
+	rows, err := c.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY version", appliedColumns, table))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "warning: error closing rows: %v\n", cerr)
+		}
+	}()
+	return scanApplied(rows)
+}
+
+// InsertVersion records an applied migration in the MySQL migrations table.
+func (d MySQLDialect) InsertVersion(ctx context.Context, c Conn, schema string, m AppliedMigration) error {
+	table := mysqlTable(schema, migrationTable)
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?, ?, ?, ?, ?, ?, CURRENT_USER(), ?, ?, ?, ?, ?)", table, appliedColumns)
+	_, err := c.ExecContext(ctx, stmt, m.Version, m.Name, m.Checksum, m.AppliedAt, m.Duration.Milliseconds(), m.AppliedBy, m.Hostname, m.ScimaVersion, m.Dirty, m.Error, m.OutOfOrder)
+	return err
+}
+
+// UpdateVersion overwrites the MySQL tracking row for m.Version.
+func (d MySQLDialect) UpdateVersion(ctx context.Context, c Conn, schema string, m AppliedMigration) error {
+	stmt := updateStatement(mysqlTable(schema, migrationTable), func(int) string { return "?" })
+	_, err := c.ExecContext(ctx, stmt, updateArgs(m)...)
+	return err
+}
+
+// DeleteVersion deletes a migration version from the MySQL migrations table.
+func (d MySQLDialect) DeleteVersion(ctx context.Context, c Conn, schema string, version int64) error {
+	table := mysqlTable(schema, migrationTable)
+	_, err := c.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = ?", table), version)
+	return err
+}
+
+// mysqlLockName derives the GET_LOCK name; MySQL limits lock names to 64 characters.
+func mysqlLockName(schema string) string {
+	name := "scima:" + mysqlTable(schema, migrationTable)
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// Lock acquires a session level named lock with GET_LOCK, polling until timeout.
+func (d MySQLDialect) Lock(ctx context.Context, c Conn, schema string, timeout time.Duration) error {
+	name := mysqlLockName(schema)
+	return pollLock(ctx, timeout, func() (bool, error) {
+		res, err := queryNullInt(ctx, c, "SELECT GET_LOCK(?, 0)", name)
+		if err != nil {
+			return false, err
+		}
+		if !res.Valid {
+			return false, errors.New("GET_LOCK failed")
+		}
+		return res.Int64 == 1, nil
+	})
+}
+
+// Unlock releases the named lock taken by Lock on the same session.
+func (d MySQLDialect) Unlock(ctx context.Context, c Conn, schema string) error {
+	res, err := queryNullInt(ctx, c, "SELECT RELEASE_LOCK(?)", mysqlLockName(schema))
+	if err != nil {
+		return err
+	}
+	if res.Int64 != 1 {
+		return errors.New("named lock was not held by this session")
+	}
+	return nil
+}
+
+// ForceUnlock always fails: named locks vanish with the session holding them,
+// so there is no stale lock to clear.
+func (d MySQLDialect) ForceUnlock(_ context.Context, _ Conn, _ string) error {
+	return errors.New("mysql named locks are released when the holding session ends; kill that session instead")
+}
+
+// mysqlLinePattern matches the "at line N" suffix of MySQL syntax errors.
+var mysqlLinePattern = regexp.MustCompile(`at line (\d+)$`)
+
+// mysqlString renders s as a string literal, escaping backslashes as MySQL requires
+// unless NO_BACKSLASH_ESCAPES is set.
+func mysqlString(s string) string {
+	return sqlString(strings.ReplaceAll(s, `\`, `\\`))
+}
+
+// mysqlScriptProcedure is the temporary procedure scripts use for conditional logic,
+// since MySQL only allows IF inside stored programs.
+const mysqlScriptProcedure = "scima_script_step"
+
+// mysqlProcedure renders body as a temporary procedure for the mysql client, which
+// needs a DELIMITER change to pass semicolons inside the body through.
+func mysqlProcedure(schema, body string) string {
+	proc := mysqlTable(schema, mysqlScriptProcedure)
+	return fmt.Sprintf("DROP PROCEDURE IF EXISTS %[1]s;\nDELIMITER $$\nCREATE PROCEDURE %[1]s()\nBEGIN\n%[2]sEND $$\nDELIMITER ;\nCALL %[1]s();\nDROP PROCEDURE %[1]s;\n", proc, body)
+}
+
+// ScriptPrologue renders a procedure creating the tracking table and adding the
+// columns information_schema does not list.
+func (d MySQLDialect) ScriptPrologue(schema string) string {
+	table := mysqlTable(schema, migrationTable)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "  CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY);\n", table)
+	for _, col := range mysqlTrackingColumns {
+		fmt.Fprintf(&sb, "  IF NOT EXISTS (SELECT 1 FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = COALESCE(NULLIF(%s, ''), DATABASE()) AND TABLE_NAME = '%s' AND COLUMN_NAME = '%s') THEN\n", mysqlString(schema), migrationTable, col.name)
+		fmt.Fprintf(&sb, "    ALTER TABLE %s ADD COLUMN %s %s;\n  END IF;\n", table, col.name, col.colType)
+	}
+	return mysqlProcedure(schema, sb.String())
+}
+
+// ScriptUp renders a procedure running the statements unless the version is recorded.
+// MySQL commits DDL implicitly, so a failing statement leaves the earlier ones applied.
+// Statements not allowed in stored programs, such as CREATE TRIGGER, fail there.
+func (d MySQLDialect) ScriptUp(schema string, m AppliedMigration, stmts []string) string {
+	table := mysqlTable(schema, migrationTable)
+	insert := insertVersionSQL(table, m, mysqlString, "UTC_TIMESTAMP(6)", "CURRENT_USER()")
+	return mysqlGuard(schema, fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s WHERE version = %d)", table, m.Version), stmts, insert)
+}
+
+// ScriptDown renders a procedure running the statements if the version is recorded.
+func (d MySQLDialect) ScriptDown(schema string, version int64, stmts []string) string {
+	table := mysqlTable(schema, migrationTable)
+	del := fmt.Sprintf("DELETE FROM %s WHERE version = %d", table, version)
+	return mysqlGuard(schema, fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE version = %d)", table, version), stmts, del)
+}
+
+// mysqlGuard renders a procedure running stmts followed by bookkeeping if cond holds.
+func mysqlGuard(schema, cond string, stmts []string, bookkeeping string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "  IF %s THEN\n", cond)
+	for _, stmt := range stmts {
+		sb.WriteString(stmt + ";\n")
+	}
+	fmt.Fprintf(&sb, "    %s;\n  END IF;\n", bookkeeping)
+	return mysqlProcedure(schema, sb.String())
+}
+
+// DescribeError returns the error number and SQLSTATE of a *mysql.MySQLError.
+// MySQL only reports the line of a syntax error within the statement, not a position.
+func (d MySQLDialect) DescribeError(err error) ErrorDetails {
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) {
+		return ErrorDetails{}
+	}
+	details := ErrorDetails{Code: strconv.Itoa(int(me.Number))}
+	if state := string(me.SQLState[:]); strings.Trim(state, "\x00") != "" {
+		details.Detail = "SQLSTATE " + state
+	}
+	if m := mysqlLinePattern.FindStringSubmatch(me.Message); m != nil {
+		details.Line, _ = strconv.Atoi(m[1])
+	}
+	return details
+}
+
+// queryNullInt runs a query returning a single nullable integer.
+func queryNullInt(ctx context.Context, c Conn, query string, args ...any) (sql.NullInt64, error) {
+	var res sql.NullInt64
+	rows, err := c.QueryContext(ctx, query, args...)
+	if err != nil {
+		return res, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "warning: error closing rows: %v\n", cerr)
+		}
+	}()
+	if rows.Next() {
+		if err := rows.Scan(&res); err != nil {
+			return res, err
+		}
+	}
+	return res, rows.Err()
+}
+
+// mysqlDDL renders declarative migrations for MySQL 8 and MariaDB 10.5 or later.
+var mysqlDDL = ddlSyntax{
+	types: map[string]string{
+		"integer": "INT", "bigint": "BIGINT", "smallint": "SMALLINT", "decimal": "DECIMAL",
+		"float": "DOUBLE", "boolean": "BOOLEAN", "string": "VARCHAR", "text": "LONGTEXT",
+		"date": "DATE", "timestamp": "DATETIME(6)", "blob": "LONGBLOB",
+	},
+	createTable:  "CREATE TABLE",
+	addColumn:    "ALTER TABLE %s ADD COLUMN %s",
+	dropColumn:   "ALTER TABLE %s DROP COLUMN %s",
+	createIndex:  "CREATE %[1]sINDEX %[2]s ON %[4]s (%[6]s)",
+	dropIndex:    "DROP INDEX %[2]s ON %[4]s",
+	renameTable:  "RENAME TABLE %[1]s TO %[3]s",
+	renameColumn: "ALTER TABLE %s RENAME COLUMN %s TO %s",
+}
+
+// RenderOperation implements DDLDialect.
+func (d MySQLDialect) RenderOperation(op Operation) ([]string, error) {
+	return mysqlDDL.render(op, d.Name())
+}
@@ -0,0 +1,45 @@
+package dialect
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestMySQLRegistered(t *testing.T) {
+	d, err := Get("mysql")
+	if err != nil {
+		t.Fatalf("mysql dialect not registered: %v", err)
+	}
+	if d.Name() != "mysql" || d.SupportsTransactionalDDL() {
+		t.Fatalf("unexpected dialect: %s transactional=%v", d.Name(), d.SupportsTransactionalDDL())
+	}
+}
+
+func TestMySQLEnsureMigrationTable(t *testing.T) {
+	c := &recordConn{}
+	if err := (MySQLDialect{}).EnsureMigrationTable(context.Background(), c, "app"); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if c.execs[0] != "CREATE TABLE IF NOT EXISTS `app`.`SCIMA_SCHEMA_MIGRATIONS` (version BIGINT PRIMARY KEY)" {
+		t.Fatalf("unexpected create: %q", c.execs[0])
+	}
+	if len(c.execs) != 1+len(mysqlTrackingColumns) || !strings.HasPrefix(c.execs[1], "ALTER TABLE `app`.`SCIMA_SCHEMA_MIGRATIONS` ADD COLUMN checksum") {
+		t.Fatalf("missing columns not added: %q", c.execs)
+	}
+}
+
+func TestMySQLDescribeError(t *testing.T) {
+	err := fmt.Errorf("exec: %w", &mysql.MySQLError{
+		Number:   1064,
+		SQLState: [5]byte{'4', '2', '0', '0', '0'},
+		Message:  "You have an error in your SQL syntax; check the manual near 'ADDD email' at line 2",
+	})
+	got := (MySQLDialect{}).DescribeError(err)
+	if got.Code != "1064" || got.Line != 2 || got.Detail != "SQLSTATE 42000" {
+		t.Fatalf("unexpected details: %+v", got)
+	}
+}
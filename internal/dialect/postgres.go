@@ -2,8 +2,15 @@ package dialect
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 // PostgresDialect implements Dialect for PostgreSQL.
@@ -12,18 +19,58 @@ type PostgresDialect struct{}
 // Name returns the name of the dialect ("postgres").
 func (p PostgresDialect) Name() string { return "postgres" }
 
+// SupportsTransactionalDDL returns true; Postgres rolls back DDL with the transaction.
+func (p PostgresDialect) SupportsTransactionalDDL() bool { return true }
+
+// CheckStatement accepts every statement.
+func (PostgresDialect) CheckStatement(string, bool) error { return nil }
+
+// postgresTrackingColumns are added to tables created by older scima versions.
+var postgresTrackingColumns = []struct{ name, colType string }{
+	{"checksum", "VARCHAR(64)"},
+	{"name", "VARCHAR(255)"},
+	{"applied_at", "TIMESTAMPTZ"},
+	{"execution_ms", "BIGINT"},
+	{"applied_by", "VARCHAR(255)"},
+	{"db_user", "VARCHAR(255)"},
+	{"hostname", "VARCHAR(255)"},
+	{"scima_version", "VARCHAR(64)"},
+	{"dirty", "BOOLEAN"},
+	{"last_error", "TEXT"},
+	{"out_of_order", "BOOLEAN"},
+}
+
 // EnsureMigrationTable creates the migration tracking table if it does not exist.
 func (p PostgresDialect) EnsureMigrationTable(ctx context.Context, c Conn, schema string) error {
+	for _, stmt := range postgresEnsureStatements(schema) {
+		if _, err := c.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postgresEnsureStatements create the tracking table and upgrade tables created
+// before all columns were tracked. Each statement is idempotent.
+func postgresEnsureStatements(schema string) []string {
 	table := qualifiedMigrationTable(schema)
-	stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY)", table)
-	_, err := c.ExecContext(ctx, stmt)
-	return err
+	stmts := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY)", table)}
+	for _, col := range postgresTrackingColumns {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, col.name, col.colType))
+	}
+	return stmts
+}
+
+// MigrationTableExists looks the tracking table up with to_regclass.
+func (p PostgresDialect) MigrationTableExists(ctx context.Context, c Conn, schema string) (bool, error) {
+	n, err := countRows(ctx, c, "SELECT CASE WHEN to_regclass($1) IS NULL THEN 0 ELSE 1 END", qualifiedMigrationTable(schema))
+	return n > 0, err
 }
 
-// SelectAppliedVersions returns a map of applied migration versions from the tracking table.
-func (p PostgresDialect) SelectAppliedVersions(ctx context.Context, c Conn, schema string) (map[int64]bool, error) {
+// SelectApplied returns the tracking table rows ordered by version.
+func (p PostgresDialect) SelectApplied(ctx context.Context, c Conn, schema string) ([]AppliedMigration, error) {
 	table := qualifiedMigrationTable(schema)
-	rows, err := c.QueryContext(ctx, fmt.Sprintf("SELECT version FROM %s", table))
+	rows, err := c.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY version", appliedColumns, table))
 	if err != nil {
 		return nil, err
 	}
@@ -32,24 +79,22 @@ func (p PostgresDialect) SelectAppliedVersions(ctx context.Context, c Conn, sche
 			fmt.Fprintf(os.Stderr, "warning: error closing rows: %v\n", cerr)
 		}
 	}()
-	res := map[int64]bool{}
-	for rows.Next() {
-		var v int64
-		if err := rows.Scan(&v); err != nil {
-			return nil, err
-		}
-		res[v] = true
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return res, nil
+	return scanApplied(rows)
 }
 
-// InsertVersion inserts a migration version into the Postgres migrations table.
-func (p PostgresDialect) InsertVersion(ctx context.Context, c Conn, schema string, version int64) error {
+// InsertVersion records an applied migration in the Postgres migrations table.
+func (p PostgresDialect) InsertVersion(ctx context.Context, c Conn, schema string, m AppliedMigration) error {
 	table := qualifiedMigrationTable(schema)
-	_, err := c.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version) VALUES ($1)", table), version)
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5, $6, CURRENT_USER, $7, $8, $9, $10, $11)", table, appliedColumns)
+	_, err := c.ExecContext(ctx, stmt, m.Version, m.Name, m.Checksum, m.AppliedAt, m.Duration.Milliseconds(), m.AppliedBy, m.Hostname, m.ScimaVersion, m.Dirty, m.Error, m.OutOfOrder)
+	return err
+}
+
+// UpdateVersion overwrites the Postgres tracking row for m.Version.
+func (p PostgresDialect) UpdateVersion(ctx context.Context, c Conn, schema string, m AppliedMigration) error {
+	table := qualifiedMigrationTable(schema)
+	stmt := updateStatement(table, func(n int) string { return fmt.Sprintf("$%d", n) })
+	_, err := c.ExecContext(ctx, stmt, updateArgs(m)...)
 	return err
 }
 
@@ -60,4 +105,135 @@ func (p PostgresDialect) DeleteVersion(ctx context.Context, c Conn, schema strin
 	return err
 }
 
+// advisoryLockKey derives a stable pg_advisory_lock key from the tracking table name.
+func advisoryLockKey(schema string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(qualifiedMigrationTable(schema)))
+	return int64(h.Sum64())
+}
+
+// Lock acquires a session level advisory lock, polling pg_try_advisory_lock until timeout.
+func (p PostgresDialect) Lock(ctx context.Context, c Conn, schema string, timeout time.Duration) error {
+	key := advisoryLockKey(schema)
+	return pollLock(ctx, timeout, func() (bool, error) {
+		return queryBool(ctx, c, "SELECT pg_try_advisory_lock($1)", key)
+	})
+}
+
+// Unlock releases the advisory lock taken by Lock on the same session.
+func (p PostgresDialect) Unlock(ctx context.Context, c Conn, schema string) error {
+	released, err := queryBool(ctx, c, "SELECT pg_advisory_unlock($1)", advisoryLockKey(schema))
+	if err != nil {
+		return err
+	}
+	if !released {
+		return errors.New("advisory lock was not held by this session")
+	}
+	return nil
+}
+
+// ForceUnlock always fails: advisory locks vanish with the session holding them,
+// so there is no stale lock to clear.
+func (p PostgresDialect) ForceUnlock(_ context.Context, _ Conn, _ string) error {
+	return errors.New("postgres advisory locks are released when the holding session ends; terminate that session instead")
+}
+
+// DescribeError returns the SQLSTATE, position, hint and detail of a *pq.Error.
+func (p PostgresDialect) DescribeError(err error) ErrorDetails {
+	var pe *pq.Error
+	if !errors.As(err, &pe) {
+		return ErrorDetails{}
+	}
+	pos, _ := strconv.Atoi(pe.Position)
+	return ErrorDetails{Code: string(pe.Code), Position: pos, Hint: pe.Hint, Detail: pe.Detail}
+}
+
+// ScriptPrologue returns the statements of EnsureMigrationTable, which are idempotent.
+func (p PostgresDialect) ScriptPrologue(schema string) string {
+	var sb strings.Builder
+	for _, stmt := range postgresEnsureStatements(schema) {
+		sb.WriteString(stmt + ";\n")
+	}
+	return sb.String()
+}
+
+// ScriptUp wraps the migration in a DO block, so it runs in one transaction and is
+// skipped if the version is recorded. Statements that cannot run inside a function,
+// such as CREATE INDEX CONCURRENTLY, fail there.
+func (p PostgresDialect) ScriptUp(schema string, m AppliedMigration, stmts []string) string {
+	table := qualifiedMigrationTable(schema)
+	insert := insertVersionSQL(table, m, sqlString, "CURRENT_TIMESTAMP", "CURRENT_USER")
+	return postgresGuard(fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s WHERE version = %d)", table, m.Version), stmts, insert)
+}
+
+// ScriptDown wraps the migration in a DO block that only runs if the version is recorded.
+func (p PostgresDialect) ScriptDown(schema string, version int64, stmts []string) string {
+	table := qualifiedMigrationTable(schema)
+	del := fmt.Sprintf("DELETE FROM %s WHERE version = %d", table, version)
+	return postgresGuard(fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE version = %d)", table, version), stmts, del)
+}
+
+// postgresGuard renders a DO block running stmts through EXECUTE, followed by
+// bookkeeping, if cond holds.
+func postgresGuard(cond string, stmts []string, bookkeeping string) string {
+	var body strings.Builder
+	fmt.Fprintf(&body, "\nBEGIN\n  IF %s THEN\n", cond)
+	for _, stmt := range stmts {
+		fmt.Fprintf(&body, "    EXECUTE %s;\n", dollarQuote(stmt))
+	}
+	fmt.Fprintf(&body, "    %s;\n  END IF;\nEND\n", bookkeeping)
+	return fmt.Sprintf("DO %s;\n", dollarQuote(body.String()))
+}
+
+// dollarQuote quotes s with the first of $scima$, $scima1$, ... that s does not contain.
+func dollarQuote(s string) string {
+	tag := "$scima$"
+	for i := 1; strings.Contains(s, tag); i++ {
+		tag = fmt.Sprintf("$scima%d$", i)
+	}
+	return tag + s + tag
+}
+
+// queryBool runs a query returning a single boolean.
+func queryBool(ctx context.Context, c Conn, query string, args ...any) (bool, error) {
+	rows, err := c.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "warning: error closing rows: %v\n", cerr)
+		}
+	}()
+	var res bool
+	if rows.Next() {
+		if err := rows.Scan(&res); err != nil {
+			return false, err
+		}
+	}
+	return res, rows.Err()
+}
+
 func init() { Register(PostgresDialect{}) }
+
+// postgresDDL renders declarative migrations for Postgres.
+var postgresDDL = ddlSyntax{
+	types: map[string]string{
+		"integer": "INTEGER", "bigint": "BIGINT", "smallint": "SMALLINT", "decimal": "NUMERIC",
+		"float": "DOUBLE PRECISION", "boolean": "BOOLEAN", "string": "VARCHAR", "text": "TEXT",
+		"date": "DATE", "timestamp": "TIMESTAMP", "blob": "BYTEA",
+	},
+	createTable: "CREATE TABLE",
+	addColumn:   "ALTER TABLE %s ADD COLUMN %s",
+	dropColumn:  "ALTER TABLE %s DROP COLUMN %s",
+	// Postgres creates an index in the schema of its table, but drops it by qualified name.
+	createIndex:  "CREATE %[1]sINDEX %[2]s ON %[4]s (%[6]s)",
+	dropIndex:    "DROP INDEX %[3]s",
+	renameTable:  "ALTER TABLE %[1]s RENAME TO %[2]s",
+	renameColumn: "ALTER TABLE %s RENAME COLUMN %s TO %s",
+}
+
+// RenderOperation implements DDLDialect.
+func (p PostgresDialect) RenderOperation(op Operation) ([]string, error) {
+	return postgresDDL.render(op, p.Name())
+}
@@ -1,6 +1,14 @@
 package dialect
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
 
 func TestPostgresDialectRegistered(t *testing.T) {
 	d, err := Get("postgres")
@@ -11,3 +19,30 @@ func TestPostgresDialectRegistered(t *testing.T) {
 		t.Fatalf("unexpected name: %s", d.Name())
 	}
 }
+
+func TestPostgresEnsureMigrationTableUpgradesColumns(t *testing.T) {
+	c := &recordConn{}
+	if err := (PostgresDialect{}).EnsureMigrationTable(context.Background(), c, ""); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if len(c.execs) != 1+len(postgresTrackingColumns) {
+		t.Fatalf("unexpected statements: %v", c.execs)
+	}
+	for _, e := range c.execs[1:] {
+		if !strings.Contains(e, "ADD COLUMN IF NOT EXISTS") {
+			t.Fatalf("upgrade not idempotent: %q", e)
+		}
+	}
+}
+
+func TestPostgresDescribeError(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &pq.Error{Code: "42601", Position: "19", Hint: "h", Detail: "d"})
+	got := (PostgresDialect{}).DescribeError(err)
+	want := ErrorDetails{Code: "42601", Position: 19, Hint: "h", Detail: "d"}
+	if got != want {
+		t.Fatalf("got %+v want %+v", got, want)
+	}
+	if (PostgresDialect{}).DescribeError(errors.New("plain")) != (ErrorDetails{}) {
+		t.Fatalf("expected empty details for non-pq error")
+	}
+}
@@ -0,0 +1,42 @@
+package dialect
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ScriptDialect is implemented by dialects that can render migrations as a SQL script
+// for a DBA to run without scima. Every migration is wrapped in a guard that checks
+// the tracking table, so running a script again skips what it already applied.
+type ScriptDialect interface {
+	Dialect
+	// ScriptPrologue creates the tracking table, or adds the columns it lacks.
+	ScriptPrologue(schema string) string
+	// ScriptUp runs stmts and records m unless m.Version is already recorded.
+	// applied_at and db_user are filled in by the database when the script runs.
+	ScriptUp(schema string, m AppliedMigration, stmts []string) string
+	// ScriptDown runs stmts and deletes the row of version if it is recorded.
+	ScriptDown(schema string, version int64, stmts []string) string
+}
+
+// sqlString renders s as a single quoted SQL string literal.
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sqlBool renders b as a boolean literal.
+func sqlBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// insertVersionSQL renders the INSERT recording m with literal values. quote renders
+// string literals; now and dbUser are the SQL expressions for applied_at and db_user.
+// The duration is unknown to a script, so execution_ms stays NULL.
+func insertVersionSQL(table string, m AppliedMigration, quote func(string) string, now, dbUser string) string {
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%d, %s, %s, %s, NULL, %s, %s, %s, %s, %s, NULL, %s)",
+		table, appliedColumns, m.Version, quote(m.Name), quote(m.Checksum), now, quote(m.AppliedBy), dbUser,
+		quote(m.Hostname), quote(m.ScimaVersion), sqlBool(m.Dirty), sqlBool(m.OutOfOrder))
+}
@@ -0,0 +1,50 @@
+package dialect
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScriptDialects(t *testing.T) {
+	m := AppliedMigration{Version: 30, Name: "users", Checksum: "abc", AppliedBy: `corp\o'neil`}
+	stmts := []string{"CREATE TABLE users (name VARCHAR(10) DEFAULT 'x')"}
+	for _, name := range []string{"hana", "postgres", "mysql"} {
+		d, err := Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sd, ok := d.(ScriptDialect)
+		if !ok {
+			t.Fatalf("%s does not implement ScriptDialect", name)
+		}
+		if p := sd.ScriptPrologue("app"); !strings.Contains(p, "SCIMA_SCHEMA_MIGRATIONS") || !strings.Contains(p, "out_of_order") {
+			t.Fatalf("%s prologue lacks tracking table:\n%s", name, p)
+		}
+		up := sd.ScriptUp("", m, stmts)
+		if !strings.Contains(up, "version = 30") || !strings.Contains(up, "INSERT INTO") || !strings.Contains(up, "'abc'") {
+			t.Fatalf("%s up lacks guard or bookkeeping:\n%s", name, up)
+		}
+		if down := sd.ScriptDown("", 30, stmts); !strings.Contains(down, "DELETE FROM") || !strings.Contains(down, "version = 30") {
+			t.Fatalf("%s down lacks guard or bookkeeping:\n%s", name, down)
+		}
+	}
+	if _, ok := any(SQLiteDialect{}).(ScriptDialect); ok {
+		t.Fatalf("sqlite has no procedural blocks to guard scripts with")
+	}
+}
+
+func TestScriptQuoting(t *testing.T) {
+	if got := sqlString("it's"); got != "'it''s'" {
+		t.Fatalf("sqlString: %s", got)
+	}
+	if got := mysqlString(`a\b'c`); got != `'a\\b''c'` {
+		t.Fatalf("mysqlString: %s", got)
+	}
+	if got := dollarQuote("SELECT $scima$x$scima$"); got != "$scima1$SELECT $scima$x$scima$$scima1$" {
+		t.Fatalf("dollarQuote: %s", got)
+	}
+	hana := (HanaDialect{}).ScriptUp("", AppliedMigration{Version: 1}, []string{"INSERT INTO t VALUES ('a')"})
+	if !strings.Contains(hana, "EXEC 'INSERT INTO t VALUES (''a'')';") {
+		t.Fatalf("hana statement not escaped:\n%s", hana)
+	}
+}
@@ -7,11 +7,20 @@ import (
 	"errors"
 )
 
-// SQLConn adapts *sql.DB or *sql.Tx into Conn.
-// Provided here so callers can wrap their own connection.
+// SQLExecutor is the subset of *sql.DB, *sql.Conn and *sql.Tx used by SQLConn.
+type SQLExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// sqlBeginner is implemented by *sql.DB and *sql.Conn.
+type sqlBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
 
-// SQLConn adapts *sql.DB or *sql.Tx into Conn for migration operations.
-type SQLConn struct{ DB *sql.DB }
+// SQLConn adapts *sql.DB, *sql.Conn or *sql.Tx into Conn for migration operations.
+// Provided here so callers can wrap their own connection.
+type SQLConn struct{ DB SQLExecutor }
 
 // ExecContext executes a query with the given arguments and returns a Result.
 func (s SQLConn) ExecContext(ctx context.Context, query string, args ...any) (Result, error) {
@@ -31,8 +40,37 @@ func (s SQLConn) QueryContext(ctx context.Context, query string, args ...any) (R
 	return rows, nil
 }
 
+// BeginTx starts a transaction. It fails when the wrapped executor is already a *sql.Tx.
+func (s SQLConn) BeginTx(ctx context.Context) (Tx, error) {
+	b, ok := s.DB.(sqlBeginner)
+	if !ok {
+		return nil, errors.New("connection cannot begin a transaction (nested transactions are not supported)")
+	}
+	tx, err := b.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return SQLTx{SQLConn: SQLConn{DB: tx}, Tx: tx}, nil
+}
+
+// SQLTx adapts *sql.Tx into Tx.
+type SQLTx struct {
+	SQLConn
+	Tx *sql.Tx
+}
+
+// Commit commits the transaction.
+func (t SQLTx) Commit() error { return t.Tx.Commit() }
+
+// Rollback aborts the transaction.
+func (t SQLTx) Rollback() error { return t.Tx.Rollback() }
+
 // Ensure SQLConn satisfies interfaces.
-var _ Conn = SQLConn{}
+var (
+	_ Conn   = SQLConn{}
+	_ TxConn = SQLConn{}
+	_ Tx     = SQLTx{}
+)
 
 // IsNotFound reports whether the error is a sql.ErrNoRows.
 func IsNotFound(err error) bool { return errors.Is(err, sql.ErrNoRows) }
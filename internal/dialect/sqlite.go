@@ -0,0 +1,254 @@
+package dialect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// SQLiteDialect implements Dialect for SQLite using the cgo-free modernc.org/sqlite driver.
+// A schema names an attached database ("main" and "temp" always exist).
+type SQLiteDialect struct{}
+
+// Name returns the name of the dialect ("sqlite").
+func (s SQLiteDialect) Name() string { return "sqlite" }
+
+func init() { Register(SQLiteDialect{}) }
+
+// SupportsTransactionalDDL returns true; SQLite rolls back DDL with the transaction.
+// PRAGMA foreign_keys is the exception: it is a no-op inside a transaction.
+func (s SQLiteDialect) SupportsTransactionalDDL() bool { return true }
+
+// sqliteForeignKeysPragma matches statements changing PRAGMA foreign_keys, which
+// SQLite silently ignores inside a transaction.
+var sqliteForeignKeysPragma = regexp.MustCompile(`(?i)^PRAGMA\s+("?\w+"?\s*\.\s*)?foreign_keys\s*[=(]`)
+
+var errForeignKeysInTx = errors.New(`PRAGMA foreign_keys has no effect inside a transaction; add "-- scima:no-transaction" to the file`)
+
+// CheckStatement rejects PRAGMA foreign_keys inside a transaction, where SQLite
+// would ignore it.
+func (s SQLiteDialect) CheckStatement(stmt string, inTx bool) error {
+	if inTx && sqliteForeignKeysPragma.MatchString(stmt) {
+		return errForeignKeysInTx
+	}
+	return nil
+}
+
+// sqliteTrackingColumns are added to tables created by older scima versions.
+var sqliteTrackingColumns = []struct{ name, colType string }{
+	{"checksum", "TEXT"},
+	{"name", "TEXT"},
+	{"applied_at", "TIMESTAMP"},
+	{"execution_ms", "INTEGER"},
+	{"applied_by", "TEXT"},
+	{"db_user", "TEXT"},
+	{"hostname", "TEXT"},
+	{"scima_version", "TEXT"},
+	{"dirty", "BOOLEAN"},
+	{"last_error", "TEXT"},
+	{"out_of_order", "BOOLEAN"},
+}
+
+// checkSchema fails unless schema is empty or the name of an attached database.
+func (s SQLiteDialect) checkSchema(ctx context.Context, c Conn, schema string) error {
+	if schema == "" {
+		return nil
+	}
+	rows, err := c.QueryContext(ctx, "SELECT name FROM pragma_database_list")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "warning: error closing rows: %v\n", cerr)
+		}
+	}()
+	var attached []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if strings.EqualFold(name, schema) {
+			return nil
+		}
+		attached = append(attached, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("sqlite schema %q is not an attached database (attached: %s); ATTACH it first or omit --schema", schema, strings.Join(attached, ", "))
+}
+
+// EnsureMigrationTable creates the migration tracking table if it does not exist.
+func (s SQLiteDialect) EnsureMigrationTable(ctx context.Context, c Conn, schema string) error {
+	if err := s.checkSchema(ctx, c, schema); err != nil {
+		return err
+	}
+	table := qualifiedMigrationTable(schema)
+	if _, err := c.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER PRIMARY KEY)", table)); err != nil {
+		return err
+	}
+	// SQLite lacks ADD COLUMN IF NOT EXISTS, so look the existing columns up first.
+	existing, err := s.columns(ctx, c, schema)
+	if err != nil {
+		return err
+	}
+	for _, col := range sqliteTrackingColumns {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := c.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.name, col.colType)); err != nil {
+			return fmt.Errorf("add column %s to %s failed: %w", col.name, table, err)
+		}
+	}
+	return nil
+}
+
+// MigrationTableExists reports whether pragma_table_info lists columns of the tracking table.
+func (s SQLiteDialect) MigrationTableExists(ctx context.Context, c Conn, schema string) (bool, error) {
+	cols, err := s.columns(ctx, c, schema)
+	return len(cols) > 0, err
+}
+
+// columns returns the lower-cased column names of the tracking table.
+func (s SQLiteDialect) columns(ctx context.Context, c Conn, schema string) (map[string]bool, error) {
+	if schema == "" {
+		schema = "main"
+	}
+	rows, err := c.QueryContext(ctx, "SELECT name FROM pragma_table_info(?, ?)", migrationTable, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "warning: error closing rows: %v\n", cerr)
+		}
+	}()
+	res := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		res[strings.ToLower(name)] = true
+	}
+	return res, rows.Err()
+}
+
+// SelectApplied returns the tracking table rows ordered by version.
+func (s SQLiteDialect) SelectApplied(ctx context.Context, c Conn, schema string) ([]AppliedMigration, error) {
+	table := qualifiedMigrationTable(schema)
+	rows, err := c.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY version", appliedColumns, table))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "warning: error closing rows: %v\n", cerr)
+		}
+	}()
+	return scanApplied(rows)
+}
+
+// InsertVersion records an applied migration in the SQLite migrations table.
+// SQLite has no database users, so db_user stays empty.
+func (s SQLiteDialect) InsertVersion(ctx context.Context, c Conn, schema string, m AppliedMigration) error {
+	table := qualifiedMigrationTable(schema)
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?, ?, ?, ?, ?, ?, NULL, ?, ?, ?, ?, ?)", table, appliedColumns)
+	_, err := c.ExecContext(ctx, stmt, m.Version, m.Name, m.Checksum, m.AppliedAt.UTC(), m.Duration.Milliseconds(), m.AppliedBy, m.Hostname, m.ScimaVersion, m.Dirty, m.Error, m.OutOfOrder)
+	return err
+}
+
+// UpdateVersion overwrites the SQLite tracking row for m.Version.
+func (s SQLiteDialect) UpdateVersion(ctx context.Context, c Conn, schema string, m AppliedMigration) error {
+	stmt := updateStatement(qualifiedMigrationTable(schema), func(int) string { return "?" })
+	m.AppliedAt = m.AppliedAt.UTC()
+	_, err := c.ExecContext(ctx, stmt, updateArgs(m)...)
+	return err
+}
+
+// DeleteVersion deletes a migration version from the SQLite migrations table.
+func (s SQLiteDialect) DeleteVersion(ctx context.Context, c Conn, schema string, version int64) error {
+	table := qualifiedMigrationTable(schema)
+	_, err := c.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = ?", table), version)
+	return err
+}
+
+// Lock inserts a row into the lock table, polling until timeout. The row lives in
+// the database file, so it also excludes other processes opening the same file.
+func (s SQLiteDialect) Lock(ctx context.Context, c Conn, schema string, timeout time.Duration) error {
+	if err := s.checkSchema(ctx, c, schema); err != nil {
+		return err
+	}
+	table := qualifiedTable(schema, lockTable)
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INTEGER PRIMARY KEY, locked_at TIMESTAMP, locked_by TEXT)", table)
+	if _, err := c.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("ensure lock table failed: %v", err)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (id, locked_at, locked_by) VALUES (1, CURRENT_TIMESTAMP, ?)", table)
+	return pollLock(ctx, timeout, func() (bool, error) {
+		_, err := c.ExecContext(ctx, insert, lockOwner())
+		if err == nil {
+			return true, nil
+		}
+		if containsIgnoreCase(err.Error(), "unique constraint") {
+			return false, nil
+		}
+		return false, err
+	})
+}
+
+// Unlock deletes the lock row if this process owns it.
+func (s SQLiteDialect) Unlock(ctx context.Context, c Conn, schema string) error {
+	table := qualifiedTable(schema, lockTable)
+	_, err := c.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = 1 AND locked_by = ?", table), lockOwner())
+	return err
+}
+
+// ForceUnlock deletes the lock row regardless of its owner.
+func (s SQLiteDialect) ForceUnlock(ctx context.Context, c Conn, schema string) error {
+	table := qualifiedTable(schema, lockTable)
+	_, err := c.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = 1", table))
+	return err
+}
+
+// DescribeError returns the (extended) result code of a *sqlite.Error.
+// SQLite reports the offending token in the message but no position.
+func (s SQLiteDialect) DescribeError(err error) ErrorDetails {
+	var se *sqlite.Error
+	if !errors.As(err, &se) {
+		return ErrorDetails{}
+	}
+	return ErrorDetails{Code: strconv.Itoa(se.Code())}
+}
+
+// sqliteDDL renders declarative migrations for SQLite. Type names only set column
+// affinity there, so they follow the SQL standard. Index names rather than table names
+// carry the schema in CREATE INDEX.
+var sqliteDDL = ddlSyntax{
+	types: map[string]string{
+		"integer": "INTEGER", "bigint": "BIGINT", "smallint": "SMALLINT", "decimal": "NUMERIC",
+		"float": "REAL", "boolean": "BOOLEAN", "string": "VARCHAR", "text": "TEXT",
+		"date": "DATE", "timestamp": "TIMESTAMP", "blob": "BLOB",
+	},
+	createTable:  "CREATE TABLE",
+	addColumn:    "ALTER TABLE %s ADD COLUMN %s",
+	dropColumn:   "ALTER TABLE %s DROP COLUMN %s",
+	createIndex:  "CREATE %[1]sINDEX %[3]s ON %[5]s (%[6]s)",
+	dropIndex:    "DROP INDEX %[3]s",
+	renameTable:  "ALTER TABLE %[1]s RENAME TO %[2]s",
+	renameColumn: "ALTER TABLE %s RENAME COLUMN %s TO %s",
+}
+
+// RenderOperation implements DDLDialect.
+func (s SQLiteDialect) RenderOperation(op Operation) ([]string, error) {
+	return sqliteDDL.render(op, s.Name())
+}
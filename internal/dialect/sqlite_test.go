@@ -0,0 +1,127 @@
+package dialect
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openSQLite returns a connection to a fresh database file; ":memory:" would give
+// every pooled connection its own database.
+func openSQLite(t *testing.T) *sql.Conn {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestSQLiteRegistered(t *testing.T) {
+	d, err := Get("sqlite")
+	if err != nil {
+		t.Fatalf("sqlite dialect not registered: %v", err)
+	}
+	if d.Name() != "sqlite" || !d.SupportsTransactionalDDL() {
+		t.Fatalf("unexpected dialect: %s transactional=%v", d.Name(), d.SupportsTransactionalDDL())
+	}
+}
+
+func TestSQLiteTrackingRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	c := SQLConn{DB: openSQLite(t)}
+	d := SQLiteDialect{}
+	if exists, err := d.MigrationTableExists(ctx, c, ""); err != nil || exists {
+		t.Fatalf("exists on an empty database: %v %v", exists, err)
+	}
+	// A table created before the tracking columns existed gets upgraded.
+	if _, err := c.ExecContext(ctx, "CREATE TABLE SCIMA_SCHEMA_MIGRATIONS (version INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	if err := d.EnsureMigrationTable(ctx, c, ""); err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if exists, err := d.MigrationTableExists(ctx, c, ""); err != nil || !exists {
+		t.Fatalf("exists after ensure: %v %v", exists, err)
+	}
+	appliedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	rec := AppliedMigration{Version: 10, Name: "init", Checksum: "abc", AppliedAt: appliedAt, Duration: 1500 * time.Millisecond, Dirty: true, OutOfOrder: true}
+	if err := d.InsertVersion(ctx, c, "", rec); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	rec.Dirty = false
+	if err := d.UpdateVersion(ctx, c, "", rec); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	rows, err := d.SelectApplied(ctx, c, "")
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Name != "init" || !rows[0].AppliedAt.Equal(appliedAt) || rows[0].Duration != 1500*time.Millisecond || rows[0].Dirty || !rows[0].OutOfOrder {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+	if err := d.DeleteVersion(ctx, c, "", 10); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+}
+
+func TestSQLiteSchemaMustBeAttached(t *testing.T) {
+	ctx := context.Background()
+	c := SQLConn{DB: openSQLite(t)}
+	d := SQLiteDialect{}
+	err := d.EnsureMigrationTable(ctx, c, "app")
+	if err == nil || !strings.Contains(err.Error(), "not an attached database") {
+		t.Fatalf("expected unattached schema error, got %v", err)
+	}
+	if _, err := c.ExecContext(ctx, "ATTACH DATABASE ? AS app", filepath.Join(t.TempDir(), "app.db")); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if err := d.EnsureMigrationTable(ctx, c, "app"); err != nil {
+		t.Fatalf("ensure in attached schema: %v", err)
+	}
+}
+
+func TestSQLiteLock(t *testing.T) {
+	ctx := context.Background()
+	c := SQLConn{DB: openSQLite(t)}
+	d := SQLiteDialect{}
+	old := lockPollInterval
+	lockPollInterval = time.Millisecond
+	defer func() { lockPollInterval = old }()
+
+	if err := d.Lock(ctx, c, "", time.Second); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if err := d.Lock(ctx, c, "", 5*time.Millisecond); err == nil || !strings.Contains(err.Error(), ErrLockTimeout.Error()) {
+		t.Fatalf("expected lock timeout, got %v", err)
+	}
+	if err := d.Unlock(ctx, c, ""); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if err := d.Lock(ctx, c, "", time.Second); err != nil {
+		t.Fatalf("relock: %v", err)
+	}
+	if err := d.ForceUnlock(ctx, c, ""); err != nil {
+		t.Fatalf("force unlock: %v", err)
+	}
+}
+
+func TestSQLiteDescribeError(t *testing.T) {
+	c := SQLConn{DB: openSQLite(t)}
+	_, err := c.ExecContext(context.Background(), "CREAT TABLE t (id INT)")
+	if err == nil {
+		t.Fatalf("expected syntax error")
+	}
+	if got := (SQLiteDialect{}).DescribeError(err); got.Code != "1" {
+		t.Fatalf("unexpected details: %+v", got)
+	}
+}
@@ -1,7 +1,13 @@
 // Package logging provides a minimal logging interface and stdlib wrapper for migration operations.
 package logging
 
-import "log"
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
 
 // Logger minimal interface for substituting structured loggers later.
 // Logger is a minimal interface for substituting structured loggers later.
@@ -18,3 +24,49 @@ func (s Std) Printf(format string, v ...any) { log.Printf(format, v...) }
 
 // Default is the default Logger implementation using Std.
 var Default Logger = Std{}
+
+// NewHandler returns a slog.Handler writing records at level and above to w in
+// format "text" (key=value pairs) or "json" (one object per line).
+func NewHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+}
+
+// ParseLevel parses a log level: debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// NewPrintfHandler returns a slog.Handler passing each record at level and above to
+// l as one key=value line. The time is left out, since Printf loggers add their own.
+func NewPrintfHandler(l Logger, level slog.Leveler) slog.Handler {
+	return slog.NewTextHandler(printfWriter{l}, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+}
+
+// printfWriter turns each write of a slog.TextHandler, which is one record, into a
+// Printf call.
+type printfWriter struct{ l Logger }
+
+func (w printfWriter) Write(p []byte) (int, error) {
+	w.l.Printf("%s", strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
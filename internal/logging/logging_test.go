@@ -1,7 +1,50 @@
 package logging
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestDefaultLogger(_ *testing.T) {
 	Default.Printf("test %d", 1) // just ensure no panic
 }
+
+type lines []string
+
+func (l *lines) Printf(format string, v ...any) { *l = append(*l, fmt.Sprintf(format, v...)) }
+
+func TestPrintfHandler(t *testing.T) {
+	var got lines
+	log := slog.New(NewPrintfHandler(&got, slog.LevelInfo))
+	log.Debug("statement executed", "line", 3)
+	log.Info("migration finished", "version", "0010", "name", "init")
+	if len(got) != 1 || got[0] != "level=INFO msg=\"migration finished\" version=0010 name=init" {
+		t.Fatalf("unexpected lines: %q", got)
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	var buf bytes.Buffer
+	level, err := ParseLevel("DEBUG")
+	if err != nil {
+		t.Fatalf("parse level: %v", err)
+	}
+	h, err := NewHandler(&buf, "json", level)
+	if err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	slog.New(h).Debug("lock acquired", "wait", time.Second)
+	if !strings.Contains(buf.String(), `"msg":"lock acquired","wait":1000000000`) {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+	if _, err := NewHandler(&buf, "xml", level); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Fatalf("expected error for unknown level")
+	}
+}
@@ -0,0 +1,114 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// timestampLayout formats timestamp based versions as YYYYMMDDHHMMSS.
+const timestampLayout = "20060102150405"
+
+// NextVersion returns the first multiple of step above the highest version in pairs,
+// so with step 10 the migrations 0010 and 0020 are followed by 0030.
+func NextVersion(pairs []MigrationPair, step int64) int64 {
+	if step <= 0 {
+		step = 1
+	}
+	var highest int64
+	for _, p := range pairs {
+		for _, f := range []*MigrationFile{p.Up, p.Down} {
+			if f != nil && f.Version > highest {
+				highest = f.Version
+			}
+		}
+	}
+	return (highest/step + 1) * step
+}
+
+// TimestampVersion returns the YYYYMMDDHHMMSS version for t in UTC.
+func TimestampVersion(t time.Time) int64 {
+	v, _ := strconv.ParseInt(t.UTC().Format(timestampLayout), 10, 64)
+	return v
+}
+
+// SanitizeName turns a free form description into a migration name matching
+// filePattern: lower case letters, digits and single underscores.
+func SanitizeName(description string) string {
+	var sb strings.Builder
+	pendingUnderscore := false
+	for _, r := range strings.ToLower(description) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if pendingUnderscore && sb.Len() > 0 {
+				sb.WriteByte('_')
+			}
+			pendingUnderscore = false
+			sb.WriteRune(r)
+			continue
+		}
+		pendingUnderscore = true
+	}
+	return sb.String()
+}
+
+// DefaultTemplate is the header written into new migration files.
+const DefaultTemplate = "-- {{.Version}} {{.Name}} ({{.Direction}})\n"
+
+// TemplateData is passed to the template rendering new migration files.
+type TemplateData struct {
+	Version   string // zero padded as in the file name
+	Name      string
+	Direction string
+}
+
+// CreateFiles writes the up and down files for a new migration into dir and returns
+// their paths. tmpl is a text/template rendered with TemplateData for both files.
+// It refuses to overwrite files and to reuse a version already present in pairs.
+func CreateFiles(dir string, pairs []MigrationPair, version int64, name, tmpl string) ([]string, error) {
+	if !filePattern.MatchString(fmt.Sprintf("%d_%s.up.sql", version, name)) {
+		return nil, fmt.Errorf("invalid migration name %q: use letters, digits and underscores", name)
+	}
+	for _, p := range pairs {
+		if p.Up != nil && p.Up.Version == version || p.Down != nil && p.Down.Version == version {
+			return nil, fmt.Errorf("version %d already exists", version)
+		}
+	}
+	t, err := template.New("migration").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	padded := fmt.Sprintf("%04d", version)
+	var created []string
+	for _, direction := range []string{"up", "down"} {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, TemplateData{Version: padded, Name: name, Direction: direction}); err != nil {
+			return created, fmt.Errorf("render template: %w", err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s_%s.%s.sql", padded, name, direction))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			if errors.Is(err, os.ErrExist) {
+				return created, fmt.Errorf("%s already exists", path)
+			}
+			return created, err
+		}
+		_, err = f.Write(buf.Bytes())
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return created, err
+		}
+		created = append(created, path)
+	}
+	return created, nil
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextVersion(t *testing.T) {
+	pairs := []MigrationPair{{Up: &MigrationFile{Version: 10}}, {Up: &MigrationFile{Version: 25}, Down: &MigrationFile{Version: 25}}}
+	if got := NextVersion(pairs, 10); got != 30 {
+		t.Fatalf("expected 30 got %d", got)
+	}
+	if got := NextVersion(nil, 10); got != 10 {
+		t.Fatalf("expected 10 for an empty directory, got %d", got)
+	}
+	if got := NextVersion(pairs, 1); got != 26 {
+		t.Fatalf("expected 26 got %d", got)
+	}
+	if got := TimestampVersion(time.Date(2025, 7, 4, 9, 5, 3, 0, time.UTC)); got != 20250704090503 {
+		t.Fatalf("unexpected timestamp version %d", got)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	cases := map[string]string{
+		"Add email to Users":    "add_email_to_users",
+		"  drop--legacy  table": "drop_legacy_table",
+		"v2.1 índex":            "v2_1_ndex",
+		"!!!":                   "",
+	}
+	for in, want := range cases {
+		if got := SanitizeName(in); got != want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCreateFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+	files, err := CreateFiles(dir, nil, 30, "add_email", "-- {{.Version}} {{.Name}} {{.Direction}}\n")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "0030_add_email.up.sql" || filepath.Base(files[1]) != "0030_add_email.down.sql" {
+		t.Fatalf("unexpected files: %v", files)
+	}
+	data, err := os.ReadFile(files[1])
+	if err != nil || string(data) != "-- 0030 add_email down\n" {
+		t.Fatalf("unexpected content %q: %v", data, err)
+	}
+	pairs, err := ScanDir(dir, "")
+	if err != nil || Validate(pairs) != nil || len(pairs) != 1 {
+		t.Fatalf("created files do not scan: %+v %v", pairs, err)
+	}
+	if _, err := CreateFiles(dir, pairs, 30, "other", DefaultTemplate); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected version collision, got %v", err)
+	}
+	if _, err := CreateFiles(dir, nil, 40, "bad-name", DefaultTemplate); err == nil {
+		t.Fatalf("expected invalid name error")
+	}
+}
@@ -0,0 +1,121 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+// declarativePattern matches declarative migrations such as 0030_add_email.yaml.
+var declarativePattern = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_]+)\.ya?ml$`)
+
+// declarativeFile is the layout of a declarative migration:
+//
+//	up:
+//	  - add_column:
+//	      table: users
+//	      column: {name: email, type: string, length: 255}
+//	down:     # optional; derived from up when every operation is reversible,
+//	          # and "down: []" marks the migration irreversible
+//	no_transaction: false
+type declarativeFile struct {
+	Up            []dialect.Operation `yaml:"up"`
+	Down          []dialect.Operation `yaml:"down"`
+	NoTransaction bool                `yaml:"no_transaction"`
+}
+
+// parseDeclarative reads a declarative migration into its up file and, if it lists
+// down operations or all of its up operations can be inverted, its down file.
+func parseDeclarative(version int64, name, fullPath string, content []byte) (up, down *MigrationFile, err error) {
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	var df declarativeFile
+	if err := dec.Decode(&df); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("parse %s: %w", fullPath, err)
+	}
+	if len(df.Up) == 0 {
+		return nil, nil, fmt.Errorf("parse %s: no up operations", fullPath)
+	}
+	for _, list := range []struct {
+		dir string
+		ops []dialect.Operation
+	}{{"up", df.Up}, {"down", df.Down}} {
+		for i, op := range list.ops {
+			err := op.Validate()
+			if err == nil && op.SQL != nil && op.SQL.Dialect != "" {
+				_, err = dialect.Get(op.SQL.Dialect)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("parse %s: %s operation %d: %w", fullPath, list.dir, i+1, err)
+			}
+		}
+	}
+	downOps := df.Down
+	if downOps == nil {
+		downOps = invertOperations(df.Up)
+	}
+	up = &MigrationFile{Version: version, Name: name, Direction: "up", FullPath: fullPath, NoTransaction: df.NoTransaction, Operations: df.Up}
+	if len(downOps) > 0 {
+		down = &MigrationFile{Version: version, Name: name, Direction: "down", FullPath: fullPath, NoTransaction: df.NoTransaction, Operations: downOps}
+	}
+	return up, down, nil
+}
+
+// invertOperations returns the operations reverting ops in reverse order, or nil if
+// any of them cannot be reverted.
+func invertOperations(ops []dialect.Operation) []dialect.Operation {
+	res := make([]dialect.Operation, len(ops))
+	for i, op := range ops {
+		inv, ok := op.Inverse()
+		if !ok {
+			return nil
+		}
+		res[len(ops)-1-i] = inv
+	}
+	return res
+}
+
+// renderOperations renders the operations of a declarative migration for d as one
+// SQL text, which the migrator then splits like a migration file.
+func renderOperations(f MigrationFile, d dialect.Dialect) (string, error) {
+	dd, ok := d.(dialect.DDLDialect)
+	if !ok {
+		return "", fmt.Errorf("dialect %s cannot render declarative migrations", d.Name())
+	}
+	var sb strings.Builder
+	for i, op := range f.Operations {
+		stmts, err := dd.RenderOperation(op)
+		if err != nil {
+			return "", fmt.Errorf("operation %d: %w", i+1, err)
+		}
+		for _, st := range stmts {
+			sb.WriteString(st)
+			sb.WriteString(";\n")
+		}
+	}
+	return sb.String(), nil
+}
+
+// fileSQL returns the SQL f runs on d, with schema placeholders expanded: the file
+// content or, for a declarative migration, its operations rendered for d.
+func fileSQL(f MigrationFile, d dialect.Dialect, schema string) (string, error) {
+	sql := f.SQL
+	if f.Operations != nil {
+		var err error
+		if sql, err = renderOperations(f, d); err != nil {
+			return "", fmt.Errorf("render %s %d: %w", f.Direction, f.Version, err)
+		}
+	}
+	expanded, err := expandPlaceholders(sql, schema)
+	if err != nil {
+		return "", fmt.Errorf("placeholder expansion %s %d: %w", f.Direction, f.Version, err)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const usersYAML = `
+up:
+  - create_table:
+      table: "{{schema?}}users"
+      columns:
+        - {name: id, type: integer, primary_key: true}
+        - {name: name, type: string, length: 100, not_null: true}
+  - create_index: {name: users_name, table: "{{schema?}}users", columns: [name]}
+  - sql:
+      up: INSERT INTO users (id, name) VALUES (1, 'ada');
+      down: DELETE FROM users;
+  - sql:
+      up: INSERT INTO users (id, name) VALUES (2, 'hana only');
+      down: DELETE FROM users WHERE id = 2;
+      dialect: hana
+`
+
+func TestSQLiteDeclarative(t *testing.T) {
+	ctx := context.Background()
+	m, pairs, conn := sqliteMigrator(t, map[string]string{
+		"0010_users.yaml": usersYAML,
+		"0020_rename.yml": "up:\n  - rename: {table: users, column: name, to: full_name}\n",
+	})
+	if len(pairs) != 2 || pairs[0].Down == nil || len(pairs[0].Down.Operations) != 4 || pairs[1].Up.Operations[0].Rename == nil {
+		t.Fatalf("unexpected pairs: %+v", pairs)
+	}
+	if err := m.ApplyUp(ctx, FilterPending(pairs, nil)); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	var name string
+	if err := conn.QueryRowContext(ctx, "SELECT full_name FROM users").Scan(&name); err != nil || name != "ada" {
+		t.Fatalf("unexpected row: %q %v", name, err)
+	}
+	if mismatches, err := m.Verify(ctx, pairs); err != nil || len(mismatches) != 0 {
+		t.Fatalf("verify: %v %v", mismatches, err)
+	}
+	applied, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if err := m.ApplyDown(ctx, ReverseForDown(pairs, applied, 0)); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if tableExists(t, conn, "users") {
+		t.Fatalf("generated down did not drop users")
+	}
+}
+
+func TestDeclarativeRepeatableNotDueAfterRun(t *testing.T) {
+	ctx := context.Background()
+	m, pairs, _ := sqliteMigrator(t, map[string]string{"0010_users.yaml": usersYAML})
+	r := *pairs[0].Up
+	r.Version, r.Name, r.Repeatable = RepeatableVersion("users"), "users", true
+	repeatables := []MigrationPair{{Up: &r}}
+	due, err := m.DueRepeatables(repeatables, nil)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("expected the repeatable to be due: %v %v", due, err)
+	}
+	if err := m.ApplyUp(ctx, due); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	applied, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if due, err := m.DueRepeatables(repeatables, applied); err != nil || len(due) != 0 {
+		t.Fatalf("repeatable due again after it ran: %v %v", due, err)
+	}
+}
+
+func TestParseDeclarative(t *testing.T) {
+	pairs, err := ScanFS(fstest.MapFS{
+		"0010_drop.yaml": {Data: []byte("up:\n  - drop_column: {table: users, column: email}\nno_transaction: true\n")},
+		"0020_keep.yaml": {Data: []byte("up:\n  - create_table: {table: t, columns: [{name: id, type: integer}]}\ndown: []\n")},
+	}, ".", "")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if pairs[0].Down != nil || !pairs[0].Up.NoTransaction || pairs[1].Down != nil {
+		t.Fatalf("irreversible migrations must have no down: %+v", pairs)
+	}
+	for name, content := range map[string]string{
+		"unknown field":     "up:\n  - drop_table: {table: t, cascade: true}\n",
+		"no up operations":  "down:\n  - drop_table: {table: t}\n",
+		"missing required":  "up:\n  - add_column: {table: t}\n",
+		"unknown dialect":   "up:\n  - sql: {up: SELECT 1, dialect: oracle}\n",
+		"two kinds per op":  "up:\n  - drop_table: {table: t}\n    sql: {up: SELECT 1}\n",
+		"not a list of ops": "up: DROP TABLE t\n",
+	} {
+		if _, err := ScanFS(fstest.MapFS{"0010_bad.yaml": {Data: []byte(content)}}, ".", ""); err == nil || !strings.Contains(err.Error(), "0010_bad.yaml") {
+			t.Fatalf("%s: expected parse error naming the file, got %v", name, err)
+		}
+	}
+	pairs, err = ScanFS(fstest.MapFS{
+		"0010_a.yaml":   {Data: []byte("up:\n  - drop_table: {table: t}\n")},
+		"0010_a.up.sql": {Data: []byte("SELECT 1;")},
+	}, ".", "postgres")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if err := Validate(pairs); err == nil || !strings.Contains(err.Error(), "version 10 has 2 generic up files, expected one: 0010_a.up.sql, 0010_a.yaml") {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+}
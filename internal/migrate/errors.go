@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+// MigrationError reports a statement that failed while applying a migration file.
+// Use errors.As to retrieve it from errors returned by ApplyUp and ApplyDown.
+type MigrationError struct {
+	Version   int64
+	Name      string
+	Direction string
+	FullPath  string
+	// Statement is the failing statement and StatementIndex its 1-based position in the file.
+	Statement      string
+	StatementIndex int
+	// Line and Column locate the error in the file: the driver reported position
+	// when available, otherwise the start of the statement.
+	Line    int
+	Column  int
+	Details dialect.ErrorDetails
+	Err     error
+
+	source string // expanded file SQL, used by Excerpt
+}
+
+// Error implements error.
+func (e *MigrationError) Error() string {
+	loc := e.FullPath
+	if loc == "" {
+		loc = e.Name
+	}
+	return fmt.Sprintf("apply %s %d failed at %s:%d:%d (statement %d): %v", e.Direction, e.Version, loc, e.Line, e.Column, e.StatementIndex, e.Err)
+}
+
+// Unwrap returns the driver error.
+func (e *MigrationError) Unwrap() error { return e.Err }
+
+// excerptContext is the number of source lines shown before and after the error line.
+const excerptContext = 2
+
+// Excerpt renders the source lines around the error with a caret under the error
+// column, followed by the driver code, hint and detail when known.
+func (e *MigrationError) Excerpt() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "  --> %s:%d:%d\n", e.FullPath, e.Line, e.Column)
+	lines := strings.Split(e.source, "\n")
+	if e.Line >= 1 && e.Line <= len(lines) {
+		first := max(1, e.Line-excerptContext)
+		last := min(len(lines), e.Line+excerptContext)
+		width := len(fmt.Sprint(last))
+		for n := first; n <= last; n++ {
+			fmt.Fprintf(&sb, "%*d | %s\n", width, n, lines[n-1])
+			if n == e.Line {
+				pad := strings.Map(func(r rune) rune {
+					if r == '\t' {
+						return '\t'
+					}
+					return ' '
+				}, prefixRunes(lines[n-1], e.Column-1))
+				fmt.Fprintf(&sb, "%*s | %s^\n", width, "", pad)
+			}
+		}
+	}
+	if e.Details.Code != "" {
+		fmt.Fprintf(&sb, "  code: %s\n", e.Details.Code)
+	}
+	if e.Details.Detail != "" {
+		fmt.Fprintf(&sb, "  detail: %s\n", e.Details.Detail)
+	}
+	if e.Details.Hint != "" {
+		fmt.Fprintf(&sb, "  hint: %s\n", e.Details.Hint)
+	}
+	return sb.String()
+}
+
+// prefixRunes returns the first n runes of s (or all of s when shorter).
+func prefixRunes(s string, n int) string {
+	i := 0
+	for ; n > 0 && i < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return s[:i]
+}
+
+// newMigrationError locates err within the file using the driver reported position.
+func (m *Migrator) newMigrationError(f MigrationFile, source string, st Statement, index int, err error) *MigrationError {
+	details := m.Dialect.DescribeError(err)
+	offset := st.Offset
+	switch {
+	case details.Position > 0:
+		// Position counts characters from the start of the statement.
+		offset += len(prefixRunes(st.SQL, details.Position-1))
+	case details.Line > 1:
+		lines := strings.SplitAfterN(st.SQL, "\n", details.Line)
+		if len(lines) == details.Line {
+			offset += len(st.SQL) - len(lines[len(lines)-1])
+		}
+	}
+	line, col := lineCol(source, offset)
+	col = utf8.RuneCountInString(source[offset-col+1:offset]) + 1
+	return &MigrationError{
+		Version:        f.Version,
+		Name:           f.Name,
+		Direction:      f.Direction,
+		FullPath:       f.FullPath,
+		Statement:      st.SQL,
+		StatementIndex: index,
+		Line:           line,
+		Column:         col,
+		Details:        details,
+		Err:            err,
+		source:         source,
+	}
+}
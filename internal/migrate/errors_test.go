@@ -0,0 +1,46 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+// positionDialect reports a fixed driver position for every error.
+type positionDialect struct {
+	mockDialect
+	pos int
+}
+
+func (d positionDialect) DescribeError(error) dialect.ErrorDetails {
+	return dialect.ErrorDetails{Code: "42601", Position: d.pos, Hint: "check the column clause"}
+}
+
+func TestMigrationErrorLocatesDriverPosition(t *testing.T) {
+	conn := &txConn{failOn: "ALTER TABLE users ADDD email TEXT"}
+	d := positionDialect{mockDialect: mockDialect{applied: map[int64]dialect.AppliedMigration{}}, pos: 19}
+	migr := NewMigrator(d, conn, "")
+	up := MigrationFile{
+		Version: 20, Name: "add_email", Direction: "up", FullPath: "migrations/0020_add_email.up.sql",
+		SQL: "CREATE TABLE t (id INT);\n\n  ALTER TABLE users ADDD email TEXT;\n",
+	}
+	err := migr.ApplyUp(context.Background(), []MigrationFile{up})
+	var me *MigrationError
+	if !errors.As(err, &me) {
+		t.Fatalf("expected *MigrationError, got %v", err)
+	}
+	if me.Line != 3 || me.Column != 21 || me.Details.Code != "42601" {
+		t.Fatalf("unexpected location: line=%d column=%d details=%+v", me.Line, me.Column, me.Details)
+	}
+	if !strings.Contains(me.Error(), "migrations/0020_add_email.up.sql:3:21") {
+		t.Fatalf("error text lacks location: %s", me.Error())
+	}
+	excerpt := me.Excerpt()
+	want := "3 |   ALTER TABLE users ADDD email TEXT;\n  |                     ^\n"
+	if !strings.Contains(excerpt, want) || !strings.Contains(excerpt, "hint: check the column clause") {
+		t.Fatalf("unexpected excerpt:\n%s", excerpt)
+	}
+}
@@ -0,0 +1,112 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+// ExecutableMigration is a migration written in Go, for changes plain SQL cannot
+// express, such as backfills that re-hash or reshape data with application code.
+type ExecutableMigration interface {
+	// Up applies the migration on c, which is the migration's transaction when the
+	// dialect supports transactional DDL, so the change and its history row commit together.
+	Up(ctx context.Context, c dialect.Conn) error
+}
+
+// ReversibleMigration is an ExecutableMigration that down and goto can revert.
+type ReversibleMigration interface {
+	ExecutableMigration
+	Down(ctx context.Context, c dialect.Conn) error
+}
+
+// MigrationFunc adapts a function to an ExecutableMigration without a down step.
+type MigrationFunc func(ctx context.Context, c dialect.Conn) error
+
+// Up calls f.
+func (f MigrationFunc) Up(ctx context.Context, c dialect.Conn) error { return f(ctx, c) }
+
+// Executable registers an ExecutableMigration under a version and name, which play
+// the same role as in a migration file name.
+type Executable struct {
+	Version   int64
+	Name      string
+	Migration ExecutableMigration
+}
+
+// executablePath stands in for the file path of Go migrations in output.
+const executablePath = "go"
+
+// MergeExecutables adds execs to pairs as migrations whose Exec is set, interleaved
+// with the versioned files by version and ahead of repeatable ones. Only execs
+// implementing ReversibleMigration get a down migration. It fails if a version is
+// already taken by a file or another Go migration.
+func MergeExecutables(pairs []MigrationPair, execs []Executable) ([]MigrationPair, error) {
+	if len(execs) == 0 {
+		return pairs, nil
+	}
+	taken := map[int64]bool{}
+	for _, p := range pairs {
+		taken[pairVersion(p)] = true
+	}
+	res := append([]MigrationPair(nil), pairs...)
+	for _, e := range execs {
+		switch {
+		case e.Migration == nil:
+			return nil, fmt.Errorf("go migration %d %s has no implementation", e.Version, e.Name)
+		case e.Version <= 0:
+			return nil, fmt.Errorf("go migration %s: version must be positive, got %d", e.Name, e.Version)
+		case !filePattern.MatchString(fmt.Sprintf("%d_%s.up.sql", e.Version, e.Name)):
+			return nil, fmt.Errorf("go migration %d: invalid name %q (use letters, digits and _)", e.Version, e.Name)
+		case taken[e.Version]:
+			return nil, fmt.Errorf("go migration %d %s: version already used by another migration", e.Version, e.Name)
+		}
+		taken[e.Version] = true
+		pair := MigrationPair{Up: &MigrationFile{Version: e.Version, Name: e.Name, Direction: "up", FullPath: executablePath, Exec: e.Migration}}
+		if _, ok := e.Migration.(ReversibleMigration); ok {
+			pair.Down = &MigrationFile{Version: e.Version, Name: e.Name, Direction: "down", FullPath: executablePath, Exec: e.Migration}
+		}
+		res = append(res, pair)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		ri, rj := res[i].Up != nil && res[i].Up.Repeatable, res[j].Up != nil && res[j].Up.Repeatable
+		if ri || rj {
+			return !ri && rj
+		}
+		return pairVersion(res[i]) < pairVersion(res[j])
+	})
+	return res, nil
+}
+
+// pairVersion returns the version of p, which may lack its up file until validated.
+func pairVersion(p MigrationPair) int64 {
+	if p.Up != nil {
+		return p.Up.Version
+	}
+	return p.Down.Version
+}
+
+// runExecutable calls the Up or Down method of f.Exec, depending on f.Direction.
+func (m *Migrator) runExecutable(ctx context.Context, c dialect.Conn, f MigrationFile) error {
+	if m.dryRun {
+		// Go code cannot be previewed, and may have side effects beyond c.
+		_, err := c.ExecContext(ctx, fmt.Sprintf("-- run Go migration %s %04d %s", f.Direction, f.Version, f.Name))
+		return err
+	}
+	var err error
+	if f.Direction == "down" {
+		rev, ok := f.Exec.(ReversibleMigration)
+		if !ok {
+			return fmt.Errorf("go migration %d %s cannot be reverted", f.Version, f.Name)
+		}
+		err = rev.Down(ctx, c)
+	} else {
+		err = f.Exec.Up(ctx, c)
+	}
+	if err != nil {
+		return fmt.Errorf("apply %s %d %s (go) failed: %w", f.Direction, f.Version, f.Name, err)
+	}
+	return nil
+}
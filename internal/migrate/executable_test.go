@@ -0,0 +1,102 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+// renameUsers is a reversible Go migration changing the case of user names.
+type renameUsers struct{}
+
+func (renameUsers) Up(ctx context.Context, c dialect.Conn) error {
+	_, err := c.ExecContext(ctx, "UPDATE users SET name = upper(name)")
+	return err
+}
+
+func (renameUsers) Down(ctx context.Context, c dialect.Conn) error {
+	_, err := c.ExecContext(ctx, "UPDATE users SET name = lower(name)")
+	return err
+}
+
+func TestMergeExecutables(t *testing.T) {
+	pairs := []MigrationPair{
+		{Up: &MigrationFile{Version: 10, Name: "init"}},
+		{Up: &MigrationFile{Version: 30, Name: "more"}},
+		{Up: &MigrationFile{Version: RepeatableVersion("views"), Name: "views", Repeatable: true}},
+	}
+	noop := MigrationFunc(func(context.Context, dialect.Conn) error { return nil })
+	merged, err := MergeExecutables(pairs, []Executable{{Version: 40, Name: "last", Migration: noop}, {Version: 20, Name: "backfill", Migration: renameUsers{}}})
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	var got []string
+	for _, p := range merged {
+		got = append(got, p.Up.Name)
+	}
+	if strings.Join(got, ",") != "init,backfill,more,last,views" {
+		t.Fatalf("unexpected order: %v", got)
+	}
+	if merged[1].Down == nil || merged[1].Down.Exec == nil || merged[3].Down != nil {
+		t.Fatalf("only reversible Go migrations get a down: %+v %+v", merged[1], merged[3])
+	}
+	if pending := FilterPending(merged, map[int64]dialect.AppliedMigration{10: {Version: 10}}); len(pending) != 3 || pending[0].Version != 20 {
+		t.Fatalf("unexpected pending: %+v", pending)
+	}
+	for _, bad := range []Executable{
+		{Version: 30, Name: "dup", Migration: noop},
+		{Version: 0, Name: "zero", Migration: noop},
+		{Version: 50, Name: "bad-name", Migration: noop},
+		{Version: 50, Name: "missing"},
+	} {
+		if _, err := MergeExecutables(pairs, []Executable{bad}); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestApplyExecutable(t *testing.T) {
+	ctx := context.Background()
+	m, pairs, conn := sqliteMigrator(t, map[string]string{
+		"0010_init.up.sql":   "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);\nINSERT INTO users (name) VALUES ('ada');",
+		"0010_init.down.sql": "DROP TABLE users;",
+	})
+	failing := MigrationFunc(func(ctx context.Context, c dialect.Conn) error {
+		if _, err := c.ExecContext(ctx, "DELETE FROM users"); err != nil {
+			return err
+		}
+		return errors.New("backfill failed")
+	})
+	pairs, err := MergeExecutables(pairs, []Executable{{Version: 20, Name: "upper", Migration: renameUsers{}}, {Version: 30, Name: "broken", Migration: failing}})
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	plan, err := m.DryRun(ctx, nil, nil, FilterPending(pairs, nil)[:2])
+	if err != nil || len(plan) != 2 || !strings.Contains(FormatPlan(plan), "-- run Go migration up 0020 upper") {
+		t.Fatalf("unexpected dry run: %v %v", plan, err)
+	}
+	err = m.ApplyUp(ctx, FilterPending(pairs, nil))
+	if err == nil || !strings.Contains(err.Error(), "apply up 30 broken (go) failed: backfill failed") {
+		t.Fatalf("expected Go migration error, got %v", err)
+	}
+	var name string
+	if err := conn.QueryRowContext(ctx, "SELECT name FROM users").Scan(&name); err != nil || name != "ADA" {
+		t.Fatalf("failed Go migration was not rolled back: %q %v", name, err)
+	}
+	applied, err := m.Status(ctx)
+	if err != nil || len(applied) != 2 || applied[20].Checksum != "" {
+		t.Fatalf("unexpected history: %+v %v", applied, err)
+	}
+	if err := m.ApplyDown(ctx, ReverseForDown(pairs, applied, 1)); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if err := conn.QueryRowContext(ctx, "SELECT name FROM users").Scan(&name); err != nil || name != "ada" {
+		t.Fatalf("Go migration not reverted: %q %v", name, err)
+	}
+	if _, err := ScriptRange(pairs, 0, 0, false); err == nil || !strings.Contains(err.Error(), "0020, 0030 are Go migrations") {
+		t.Fatalf("expected script error, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+// Hooks are called around a run of migrations, under the migration lock. Embed
+// NoHooks to implement only some of them.
+type Hooks interface {
+	// BeforeAll is called before the first migration of a run that has any; an
+	// error cancels the run.
+	BeforeAll(ctx context.Context, c dialect.Conn, plan []MigrationFile) error
+	// BeforeMigration is called before f runs, on f's transaction if it has one;
+	// an error fails f.
+	BeforeMigration(ctx context.Context, c dialect.Conn, f MigrationFile) error
+	// AfterMigration is called once f ran, on f's transaction before it commits if
+	// it has one; an error fails f.
+	AfterMigration(ctx context.Context, c dialect.Conn, f MigrationFile, took time.Duration) error
+	// OnError is called when f failed, after its transaction was rolled back.
+	OnError(ctx context.Context, f MigrationFile, took time.Duration, err error)
+	// AfterAll is called after the last migration of a successful run. An error is
+	// returned by the run, but the migrations stay applied.
+	AfterAll(ctx context.Context, c dialect.Conn, ran []MigrationFile, took time.Duration) error
+}
+
+// NoHooks implements Hooks with callbacks that do nothing.
+type NoHooks struct{}
+
+// BeforeAll implements Hooks.
+func (NoHooks) BeforeAll(context.Context, dialect.Conn, []MigrationFile) error { return nil }
+
+// BeforeMigration implements Hooks.
+func (NoHooks) BeforeMigration(context.Context, dialect.Conn, MigrationFile) error { return nil }
+
+// AfterMigration implements Hooks.
+func (NoHooks) AfterMigration(context.Context, dialect.Conn, MigrationFile, time.Duration) error {
+	return nil
+}
+
+// OnError implements Hooks.
+func (NoHooks) OnError(context.Context, MigrationFile, time.Duration, error) {}
+
+// AfterAll implements Hooks.
+func (NoHooks) AfterAll(context.Context, dialect.Conn, []MigrationFile, time.Duration) error {
+	return nil
+}
+
+// SQLHooks holds SQL files run at the same points as Hooks, in the migrations
+// directory by convention: beforeMigrate.sql, beforeEach.sql, afterEach.sql,
+// afterMigrate.sql and afterMigrateError.sql. Each may have dialect variants like
+// migration files, e.g. afterEach.postgres.sql. Nil fields are skipped.
+type SQLHooks struct {
+	BeforeMigrate     *MigrationFile
+	BeforeEach        *MigrationFile
+	AfterEach         *MigrationFile
+	AfterMigrate      *MigrationFile
+	AfterMigrateError *MigrationFile
+}
+
+// hookPattern matches SQL hook files such as afterEach.sql or afterEach.postgres.sql.
+var hookPattern = regexp.MustCompile(`^(beforeMigrate|beforeEach|afterEach|afterMigrate|afterMigrateError)(?:\.([a-z][a-z0-9]*))?\.sql$`)
+
+// ScanHooksDir reads the SQL hooks in dir, picking the variants for dialectName
+// over generic files as ScanDir does.
+func ScanHooksDir(dir, dialectName string) (SQLHooks, error) {
+	return scanHooks(os.DirFS(dir), ".", dialectName, func(name string) string { return filepath.Join(dir, name) })
+}
+
+// ScanHooksFS reads the SQL hooks in directory dir of fsys like ScanHooksDir.
+func ScanHooksFS(fsys fs.FS, dir, dialectName string) (SQLHooks, error) {
+	return scanHooks(fsys, dir, dialectName, func(name string) string { return path.Join(dir, name) })
+}
+
+func scanHooks(fsys fs.FS, dir, dialectName string, fullPath func(name string) string) (SQLHooks, error) {
+	var hooks SQLHooks
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return hooks, fmt.Errorf("read migrations %s: %w", fullPath(""), err)
+	}
+	slots := map[string]**MigrationFile{
+		"beforeMigrate":     &hooks.BeforeMigrate,
+		"beforeEach":        &hooks.BeforeEach,
+		"afterEach":         &hooks.AfterEach,
+		"afterMigrate":      &hooks.AfterMigrate,
+		"afterMigrateError": &hooks.AfterMigrateError,
+	}
+	for _, e := range entries {
+		h := hookPattern.FindStringSubmatch(e.Name())
+		if e.IsDir() || h == nil {
+			continue
+		}
+		name, variant := h[1], h[2]
+		slot := slots[name]
+		if variant != "" && variant != dialectName || variant == "" && *slot != nil {
+			continue // another dialect's variant, or a generic file after the variant
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return hooks, err
+		}
+		*slot = &MigrationFile{Name: name, Direction: "hook", FullPath: fullPath(e.Name()), SQL: string(content), Dialect: variant}
+	}
+	return hooks, nil
+}
+
+// ApplyPlan reverts downs and then applies ups like ApplyDown and ApplyUp, with
+// the BeforeAll and AfterAll hooks around them when there is anything to run.
+func (m *Migrator) ApplyPlan(ctx context.Context, downs, ups []MigrationFile) error {
+	m.logPlan(ctx, downs, ups)
+	applied, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return m.applyPlan(ctx, applied, downs, ups)
+}
+
+// applyPlan implements ApplyPlan given the current tracking table rows. A dirty
+// database fails with ErrDirty even when there is nothing to run.
+func (m *Migrator) applyPlan(ctx context.Context, applied map[int64]dialect.AppliedMigration, downs, ups []MigrationFile) error {
+	if err := checkClean(applied); err != nil {
+		return err
+	}
+	if len(downs)+len(ups) == 0 {
+		return nil
+	}
+	plan := append(append([]MigrationFile{}, downs...), ups...)
+	start := time.Now()
+	if err := m.runPlanHook(ctx, m.SQLHooks.BeforeMigrate); err != nil {
+		return err
+	}
+	for _, h := range m.activeHooks() {
+		if err := h.BeforeAll(ctx, m.Conn, plan); err != nil {
+			return fmt.Errorf("before all hook: %w", err)
+		}
+	}
+	if err := m.applyDown(ctx, applied, downs); err != nil {
+		return err
+	}
+	// Versions applied by ups are not added, so the out-of-order check sees the
+	// highest version applied before the run.
+	state := maps.Clone(applied)
+	for _, down := range downs {
+		delete(state, down.Version)
+	}
+	if err := m.applyUp(ctx, state, ups); err != nil {
+		return err
+	}
+	if err := m.runPlanHook(ctx, m.SQLHooks.AfterMigrate); err != nil {
+		return err
+	}
+	for _, h := range m.activeHooks() {
+		if err := h.AfterAll(ctx, m.Conn, plan, time.Since(start)); err != nil {
+			return fmt.Errorf("after all hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// runPlanHook runs hook, if set, before or after all migrations of a run.
+func (m *Migrator) runPlanHook(ctx context.Context, hook *MigrationFile) error {
+	if hook == nil {
+		return nil
+	}
+	if err := m.runSQLHook(ctx, m.Conn, hook, MigrationFile{}, false); err != nil {
+		return err
+	}
+	m.recorded(*hook)
+	return nil
+}
+
+// runMigration runs f on c with the per-migration hooks around it; see execStatements.
+func (m *Migrator) runMigration(ctx context.Context, c dialect.Conn, f MigrationFile, expanded string, inTx bool) error {
+	start := time.Now()
+	if err := m.runSQLHook(ctx, c, m.SQLHooks.BeforeEach, f, inTx); err != nil {
+		return err
+	}
+	for _, h := range m.activeHooks() {
+		if err := h.BeforeMigration(ctx, c, f); err != nil {
+			return fmt.Errorf("before migration hook for %s %d: %w", f.Direction, f.Version, err)
+		}
+	}
+	if err := m.execStatements(ctx, c, f, expanded, inTx); err != nil {
+		return err
+	}
+	if err := m.runSQLHook(ctx, c, m.SQLHooks.AfterEach, f, inTx); err != nil {
+		return err
+	}
+	for _, h := range m.activeHooks() {
+		if err := h.AfterMigration(ctx, c, f, time.Since(start)); err != nil {
+			return fmt.Errorf("after migration hook for %s %d: %w", f.Direction, f.Version, err)
+		}
+	}
+	return nil
+}
+
+// migrationFailed calls the error hooks for f, which failed with err after took.
+func (m *Migrator) migrationFailed(ctx context.Context, f MigrationFile, took time.Duration, err error) error {
+	for _, h := range m.activeHooks() {
+		h.OnError(ctx, f, took, err)
+	}
+	if herr := m.runSQLHook(context.WithoutCancel(ctx), m.Conn, m.SQLHooks.AfterMigrateError, f, false); herr != nil {
+		return fmt.Errorf("%w (%v)", err, herr)
+	}
+	return err
+}
+
+// activeHooks returns the Go hooks to call; a dry run calls none, as they may have
+// side effects beyond the connection.
+func (m *Migrator) activeHooks() []Hooks {
+	if m.dryRun {
+		return nil
+	}
+	return m.Hooks
+}
+
+// runSQLHook runs hook, if set, on c for migration f; f is zero for the hooks run
+// before or after all migrations.
+func (m *Migrator) runSQLHook(ctx context.Context, c dialect.Conn, hook *MigrationFile, f MigrationFile, inTx bool) error {
+	if hook == nil {
+		return nil
+	}
+	hf := *hook
+	hf.Version = f.Version
+	expanded, err := expandPlaceholders(hf.SQL, m.Schema)
+	if err != nil {
+		return fmt.Errorf("placeholder expansion %s hook: %w", hf.Name, err)
+	}
+	if err := m.execStatements(ctx, c, hf, expanded, inTx); err != nil {
+		return fmt.Errorf("%s hook: %w", hf.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+// recordingHooks notes each callback it receives.
+type recordingHooks struct {
+	NoHooks
+	events []string
+}
+
+func (h *recordingHooks) BeforeAll(_ context.Context, _ dialect.Conn, plan []MigrationFile) error {
+	h.events = append(h.events, fmt.Sprintf("before all %d", len(plan)))
+	return nil
+}
+
+func (h *recordingHooks) AfterMigration(ctx context.Context, c dialect.Conn, f MigrationFile, _ time.Duration) error {
+	h.events = append(h.events, fmt.Sprintf("after %s %d", f.Direction, f.Version))
+	_, err := c.ExecContext(ctx, "INSERT INTO hook_log VALUES ('go hook')")
+	return err
+}
+
+func (h *recordingHooks) OnError(_ context.Context, f MigrationFile, _ time.Duration, err error) {
+	h.events = append(h.events, fmt.Sprintf("error %d: %v", f.Version, err))
+}
+
+func (h *recordingHooks) AfterAll(_ context.Context, _ dialect.Conn, ran []MigrationFile, _ time.Duration) error {
+	h.events = append(h.events, fmt.Sprintf("after all %d", len(ran)))
+	return nil
+}
+
+func TestScanHooks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"beforeEach.sql":          {Data: []byte("SELECT 1;")},
+		"afterEach.sql":           {Data: []byte("SELECT 2;")},
+		"afterEach.postgres.sql":  {Data: []byte("ANALYZE;")},
+		"afterMigrate.sqlite.sql": {Data: []byte("PRAGMA optimize;")},
+		"afterMigrate.sql":        {Data: []byte("SELECT 3;")},
+		"0010_init.up.sql":        {Data: []byte("SELECT 4;")},
+	}
+	hooks, err := ScanHooksFS(fsys, ".", "postgres")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if hooks.BeforeEach.SQL != "SELECT 1;" || hooks.AfterEach.SQL != "ANALYZE;" || hooks.AfterMigrate.SQL != "SELECT 3;" || hooks.BeforeMigrate != nil || hooks.AfterMigrateError != nil {
+		t.Fatalf("unexpected postgres hooks: %+v", hooks)
+	}
+	if hooks, err = ScanHooksFS(fsys, ".", "sqlite"); err != nil || hooks.AfterEach.SQL != "SELECT 2;" || hooks.AfterMigrate.SQL != "PRAGMA optimize;" {
+		t.Fatalf("unexpected sqlite hooks: %+v %v", hooks, err)
+	}
+	if pairs, err := ScanFS(fsys, ".", "sqlite"); err != nil || len(pairs) != 1 {
+		t.Fatalf("hook files must not be taken for migrations: %+v %v", pairs, err)
+	}
+}
+
+func TestApplyPlanHooks(t *testing.T) {
+	ctx := context.Background()
+	m, pairs, conn := sqliteMigrator(t, map[string]string{
+		"0010_users.up.sql":  "CREATE TABLE users (id INTEGER PRIMARY KEY);",
+		"0020_orders.up.sql": "CREATE TABLE orders (id INTEGER PRIMARY KEY);",
+		"0030_bad.up.sql":    "INSERT INTO nope VALUES (1);",
+	})
+	hooks, err := ScanHooksFS(fstest.MapFS{
+		"beforeMigrate.sql":     {Data: []byte("CREATE TABLE IF NOT EXISTS hook_log (event TEXT);")},
+		"afterEach.sql":         {Data: []byte("INSERT INTO hook_log VALUES ('sql hook');")},
+		"afterMigrateError.sql": {Data: []byte("INSERT INTO hook_log VALUES ('failed');")},
+	}, ".", "sqlite")
+	if err != nil {
+		t.Fatalf("scan hooks: %v", err)
+	}
+	rec := &recordingHooks{}
+	m.Hooks, m.SQLHooks = []Hooks{rec}, hooks
+	pending := FilterPending(pairs, nil)
+	if err := m.ApplyPlan(ctx, nil, pending[:2]); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	err = m.ApplyPlan(ctx, nil, pending[2:])
+	if err == nil || !strings.Contains(err.Error(), "no such table: nope") {
+		t.Fatalf("expected failure of 0030, got %v", err)
+	}
+	want := "before all 2,after up 10,after up 20,after all 2,before all 1,error 30: "
+	if got := strings.Join(rec.events, ","); !strings.HasPrefix(got, want) {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	var log []string
+	rows, err := conn.QueryContext(ctx, "SELECT event FROM hook_log")
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e string
+		if err := rows.Scan(&e); err != nil {
+			t.Fatal(err)
+		}
+		log = append(log, e)
+	}
+	if strings.Join(log, ",") != "sql hook,go hook,sql hook,go hook,failed" {
+		t.Fatalf("unexpected hook log: %v", log)
+	}
+
+	rec.events = nil
+	plan, err := m.DryRun(ctx, nil, nil, pending[:1])
+	if err != nil || !strings.Contains(FormatPlan(plan), "INSERT INTO hook_log VALUES ('sql hook')") || len(rec.events) != 0 {
+		t.Fatalf("dry run must show SQL hooks but not call Go hooks: %v %v %v", FormatPlan(plan), rec.events, err)
+	}
+	if len(plan) != 2 || plan[0].File.Name != "beforeMigrate" || len(plan[0].Statements) != 1 || plan[0].Statements[0].SQL != "CREATE TABLE IF NOT EXISTS hook_log (event TEXT)" {
+		t.Fatalf("dry run must show beforeMigrate.sql ahead of the migrations: %+v", plan)
+	}
+	if script := FormatScript(plan); !strings.Contains(script, "-- >>> hook beforeMigrate") || !strings.Contains(script, "CREATE TABLE IF NOT EXISTS hook_log (event TEXT);") {
+		t.Fatalf("script misses beforeMigrate.sql:\n%s", script)
+	}
+	if err := m.ApplyPlan(ctx, nil, nil); err != nil || len(rec.events) != 0 {
+		t.Fatalf("an empty run must not call hooks: %v %v", rec.events, err)
+	}
+}
@@ -3,17 +3,35 @@ package migrate
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/scima/scima/internal/dialect"
+	"github.com/scima/scima/internal/version"
 )
 
 // Migrator executes migrations for a dialect.
 type Migrator struct {
-	Conn    dialect.Conn
-	Dialect dialect.Dialect
-	Schema  string // optional schema qualifier
+	Conn        dialect.Conn
+	Dialect     dialect.Dialect
+	Schema      string        // optional schema qualifier
+	LockTimeout time.Duration // how long WithLock waits for a concurrent run to finish
+	Log         *slog.Logger  // receives lock, plan, migration and statement events; nil disables logging
+	Hooks       []Hooks       // called in order around each run and migration
+	SQLHooks    SQLHooks      // SQL files run alongside Hooks, see ScanHooksDir
+	// AllowOutOfOrder lets ApplyUp run migrations older than the highest applied version.
+	AllowOutOfOrder bool
+
+	dryRun   bool                // set by DryRun, which must not call into Go migrations
+	recorder func(MigrationFile) // set by DryRun to collect the statements of each file
 }
 
 // NewMigrator creates a new Migrator for the given dialect and connection.
@@ -26,48 +44,586 @@ func (m *Migrator) EnsureMigrationTable(ctx context.Context) error {
 	return m.Dialect.EnsureMigrationTable(ctx, m.Conn, m.Schema)
 }
 
-// Status returns applied version set.
-func (m *Migrator) Status(ctx context.Context) (map[int64]bool, error) {
+// WithLock runs fn while holding the dialect's migration lock, so concurrent
+// processes cannot plan and apply the same migrations twice.
+func (m *Migrator) WithLock(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	start := time.Now()
+	if err := m.Dialect.Lock(ctx, m.Conn, m.Schema, m.LockTimeout); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	m.log(ctx, slog.LevelInfo, "lock acquired", slog.Duration("wait", time.Since(start)))
+	defer func() {
+		if uerr := m.Dialect.Unlock(context.WithoutCancel(ctx), m.Conn, m.Schema); uerr != nil && err == nil {
+			err = fmt.Errorf("release migration lock: %w", uerr)
+		}
+	}()
+	return fn(ctx)
+}
+
+// ForceUnlock clears a stale migration lock.
+func (m *Migrator) ForceUnlock(ctx context.Context) error {
+	return m.Dialect.ForceUnlock(ctx, m.Conn, m.Schema)
+}
+
+// Status returns the applied migrations keyed by version.
+func (m *Migrator) Status(ctx context.Context) (map[int64]dialect.AppliedMigration, error) {
+	rows, err := m.History(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]dialect.AppliedMigration, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// History returns the applied migrations in the order they were applied.
+func (m *Migrator) History(ctx context.Context) ([]dialect.AppliedMigration, error) {
 	if err := m.Dialect.EnsureMigrationTable(ctx, m.Conn, m.Schema); err != nil {
 		return nil, err
 	}
-	return m.Dialect.SelectAppliedVersions(ctx, m.Conn, m.Schema)
+	rows, err := m.Dialect.SelectApplied(ctx, m.Conn, m.Schema)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if !rows[i].AppliedAt.Equal(rows[j].AppliedAt) {
+			return rows[i].AppliedAt.Before(rows[j].AppliedAt)
+		}
+		return rows[i].Version < rows[j].Version
+	})
+	return rows, nil
+}
+
+// ErrDirty is returned while a migration that failed halfway awaits manual repair.
+var ErrDirty = errors.New("database is dirty")
+
+// maxErrorLen bounds the error text stored in the tracking table.
+const maxErrorLen = 4000
+
+// checkClean fails with ErrDirty if any applied row is marked dirty.
+func checkClean(applied map[int64]dialect.AppliedMigration) error {
+	for _, v := range sortedVersions(applied) {
+		rec := applied[v]
+		if !rec.Dirty {
+			continue
+		}
+		if rec.Repeatable() {
+			// "--" keeps the negative tracking version from being parsed as a flag.
+			return fmt.Errorf("%w: repeatable migration %s did not complete (%s); repair the database manually, then run `scima force -- %d`", ErrDirty, rec.Name, rec.Error, v)
+		}
+		return fmt.Errorf("%w: version %d did not complete (%s); repair the database manually, then run `scima force %d`", ErrDirty, v, rec.Error, v)
+	}
+	return nil
+}
+
+func sortedVersions(applied map[int64]dialect.AppliedMigration) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+// OutOfOrderError reports pending migrations older than the highest applied version,
+// typically merged from a branch after newer migrations were deployed.
+type OutOfOrderError struct {
+	Versions   []int64
+	MaxApplied int64
+}
+
+// Error implements error.
+func (e *OutOfOrderError) Error() string {
+	versions := make([]string, len(e.Versions))
+	for i, v := range e.Versions {
+		versions[i] = fmt.Sprintf("%04d", v)
+	}
+	return fmt.Sprintf("migration(s) %s are older than the latest applied version %04d; rerun with --allow-out-of-order to apply them anyway", strings.Join(versions, ", "), e.MaxApplied)
+}
+
+// maxVersion returns the highest applied version, or 0 if none is applied.
+func maxVersion(applied map[int64]dialect.AppliedMigration) int64 {
+	var highest int64
+	for v := range applied {
+		highest = max(highest, v)
+	}
+	return highest
+}
+
+// OutOfOrder returns the pending up migrations older than the highest applied version.
+func OutOfOrder(pairs []MigrationPair, applied map[int64]dialect.AppliedMigration) []MigrationFile {
+	highest := maxVersion(applied)
+	var res []MigrationFile
+	for _, up := range FilterPending(pairs, applied) {
+		if up.Version < highest {
+			res = append(res, up)
+		}
+	}
+	return res
 }
 
 // ApplyUp applies pending up migrations.
+// Migrations older than the highest applied version fail with *OutOfOrderError
+// unless AllowOutOfOrder is set, in which case their rows are flagged OutOfOrder.
+// Each migration and its bookkeeping row share one transaction when possible, see txConn.
+// Otherwise the version is recorded as dirty before the SQL runs and cleaned afterwards,
+// so a failure halfway leaves a visible dirty row instead of silently missing one.
 func (m *Migrator) ApplyUp(ctx context.Context, ups []MigrationFile) error {
+	applied, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return m.applyUp(ctx, applied, ups)
+}
+
+// applyUp implements ApplyUp given the current tracking table rows.
+func (m *Migrator) applyUp(ctx context.Context, applied map[int64]dialect.AppliedMigration, ups []MigrationFile) error {
+	if err := checkClean(applied); err != nil {
+		return err
+	}
+	highest := maxVersion(applied)
+	if !m.AllowOutOfOrder {
+		var older []int64
+		for _, up := range ups {
+			if !up.Repeatable && up.Version < highest {
+				older = append(older, up.Version)
+			}
+		}
+		if len(older) > 0 {
+			return &OutOfOrderError{Versions: older, MaxApplied: highest}
+		}
+	}
 	for _, up := range ups {
-		expanded, err := expandPlaceholders(up.SQL, m.Schema)
+		expanded, err := fileSQL(up, m.Dialect, m.Schema)
 		if err != nil {
-			return fmt.Errorf("placeholder expansion up %d: %w", up.Version, err)
+			return err
 		}
-		if _, err := m.Conn.ExecContext(ctx, expanded); err != nil {
-			return fmt.Errorf("apply up %d failed: %w", up.Version, err)
+		start := m.started(ctx, up)
+		rec := m.record(up, checksumOf(up, expanded), start)
+		rec.OutOfOrder = !up.Repeatable && up.Version < highest
+		// A changed repeatable migration replaces the row of its previous run.
+		_, replace := applied[up.Version]
+		if txc, ok := m.txConn(up); ok {
+			err = m.inTx(ctx, txc, up, func(c dialect.Conn) error {
+				if err := m.runMigration(ctx, c, up, expanded, true); err != nil {
+					return err
+				}
+				rec.Duration = time.Since(start)
+				return m.saveVersion(ctx, c, rec, replace)
+			})
+		} else {
+			err = m.applyUpDirty(ctx, up, expanded, rec, replace)
 		}
-		if err := m.Dialect.InsertVersion(ctx, m.Conn, m.Schema, up.Version); err != nil {
-			return err
+		if err != nil {
+			m.failed(ctx, up, start, err)
+			return m.migrationFailed(ctx, up, time.Since(start), err)
+		}
+		m.finished(ctx, up, start)
+		m.recorded(up)
+	}
+	return nil
+}
+
+// applyUpDirty runs an up migration without a transaction, tracking rec as dirty until it succeeds.
+func (m *Migrator) applyUpDirty(ctx context.Context, up MigrationFile, expanded string, rec dialect.AppliedMigration, replace bool) error {
+	rec.Dirty = true
+	if err := m.saveVersion(ctx, m.Conn, rec, replace); err != nil {
+		return fmt.Errorf("mark %d dirty: %w", up.Version, err)
+	}
+	if err := m.runMigration(ctx, m.Conn, up, expanded, false); err != nil {
+		return m.recordFailure(ctx, rec, err)
+	}
+	rec.Dirty = false
+	rec.Duration = time.Since(rec.AppliedAt)
+	return m.Dialect.UpdateVersion(ctx, m.Conn, m.Schema, rec)
+}
+
+// saveVersion inserts rec, or overwrites the existing row if replace is set.
+func (m *Migrator) saveVersion(ctx context.Context, c dialect.Conn, rec dialect.AppliedMigration, replace bool) error {
+	if replace {
+		return m.Dialect.UpdateVersion(ctx, c, m.Schema, rec)
+	}
+	return m.Dialect.InsertVersion(ctx, c, m.Schema, rec)
+}
+
+// DueRepeatables returns the repeatable migrations in pairs that were never applied
+// or whose SQL, as applyUp checksums it, changed since they last ran.
+func (m *Migrator) DueRepeatables(pairs []MigrationPair, applied map[int64]dialect.AppliedMigration) ([]MigrationFile, error) {
+	var res []MigrationFile
+	for _, p := range pairs {
+		if p.Up == nil || !p.Up.Repeatable {
+			continue
+		}
+		expanded, err := fileSQL(*p.Up, m.Dialect, m.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("repeatable %s: %w", p.Up.Name, err)
+		}
+		if rec, ok := applied[p.Up.Version]; !ok || rec.Checksum != checksumOf(*p.Up, expanded) {
+			res = append(res, *p.Up)
+		}
+	}
+	return res, nil
+}
+
+// execStatements splits expanded SQL with the dialect's lexical rules and executes
+// the statements one by one on c, a transaction opened for f if inTx is set, since
+// not every driver accepts multi-statement strings; Go migrations run their Exec
+// method instead.
+func (m *Migrator) execStatements(ctx context.Context, c dialect.Conn, f MigrationFile, expanded string, inTx bool) error {
+	if f.Exec != nil {
+		return m.runExecutable(ctx, c, f)
+	}
+	stmts, err := SplitStatements(expanded, m.Dialect.Name())
+	if err != nil {
+		return fmt.Errorf("split %s %d: %w", f.Direction, f.Version, err)
+	}
+	for i, st := range stmts {
+		if err := m.Dialect.CheckStatement(st.SQL, inTx); err != nil {
+			return m.newMigrationError(f, expanded, st, i+1, err)
 		}
+		start := time.Now()
+		if _, err := c.ExecContext(ctx, st.SQL); err != nil {
+			return m.newMigrationError(f, expanded, st, i+1, err)
+		}
+		m.log(ctx, slog.LevelDebug, "statement executed", append(fileAttrs(f),
+			slog.Int("statement", i+1), slog.Int("line", st.Line), slog.Duration("duration", time.Since(start)), slog.String("sql", st.SQL))...)
 	}
 	return nil
 }
 
-// ApplyDown applies downs.
+// recordFailure stores err on the dirty row and returns it.
+func (m *Migrator) recordFailure(ctx context.Context, rec dialect.AppliedMigration, err error) error {
+	rec.Error = err.Error()
+	if len(rec.Error) > maxErrorLen {
+		rec.Error = rec.Error[:maxErrorLen]
+	}
+	if uerr := m.Dialect.UpdateVersion(context.WithoutCancel(ctx), m.Conn, m.Schema, rec); uerr != nil {
+		return fmt.Errorf("%w (recording failure also failed: %v)", err, uerr)
+	}
+	return err
+}
+
+// record builds the history row for an up migration that started at start.
+func (m *Migrator) record(up MigrationFile, checksum string, start time.Time) dialect.AppliedMigration {
+	return dialect.AppliedMigration{
+		Version:      up.Version,
+		Name:         up.Name,
+		Checksum:     checksum,
+		AppliedAt:    start.UTC(),
+		Duration:     time.Since(start),
+		AppliedBy:    osUser(),
+		Hostname:     hostname(),
+		ScimaVersion: version.String(),
+	}
+}
+
+func osUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
+// ChecksumMismatch describes an applied migration whose up file changed since it was applied.
+type ChecksumMismatch struct {
+	Version  int64
+	Name     string
+	FullPath string
+	Applied  string // checksum recorded when the migration ran
+	Current  string // checksum of the file as it is now
+}
+
+// Verify compares recorded checksums against the expanded up SQL of applied migrations,
+// as rendered for the dialect in the case of declarative ones.
+// Versions recorded before checksums were tracked have no checksum and are skipped, as
+// are repeatable migrations, which are meant to change.
+func (m *Migrator) Verify(ctx context.Context, pairs []MigrationPair) ([]ChecksumMismatch, error) {
+	recorded, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var res []ChecksumMismatch
+	for _, p := range pairs {
+		if p.Up == nil || p.Up.Repeatable {
+			continue
+		}
+		applied := recorded[p.Up.Version].Checksum
+		if applied == "" {
+			continue
+		}
+		expanded, err := fileSQL(*p.Up, m.Dialect, m.Schema)
+		if err != nil {
+			return nil, err
+		}
+		if current := Checksum(expanded); current != applied {
+			res = append(res, ChecksumMismatch{Version: p.Up.Version, Name: p.Up.Name, FullPath: p.Up.FullPath, Applied: applied, Current: current})
+		}
+	}
+	return res, nil
+}
+
+// checksumOf returns the checksum recorded for f. Go migrations have no SQL to
+// checksum, so Verify skips them like rows recorded before checksums were tracked.
+func checksumOf(f MigrationFile, expanded string) string {
+	if f.Exec != nil {
+		return ""
+	}
+	return Checksum(expanded)
+}
+
+// Checksum returns the hex encoded SHA-256 of migration SQL.
+func Checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+// ApplyDown applies downs, tracking non-transactional ones as dirty like ApplyUp.
 func (m *Migrator) ApplyDown(ctx context.Context, downs []MigrationFile) error {
+	applied, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return m.applyDown(ctx, applied, downs)
+}
+
+// applyDown implements ApplyDown given the current tracking table rows.
+func (m *Migrator) applyDown(ctx context.Context, applied map[int64]dialect.AppliedMigration, downs []MigrationFile) error {
+	if err := checkClean(applied); err != nil {
+		return err
+	}
 	for _, down := range downs {
-		expanded, err := expandPlaceholders(down.SQL, m.Schema)
+		expanded, err := fileSQL(down, m.Dialect, m.Schema)
 		if err != nil {
-			return fmt.Errorf("placeholder expansion down %d: %w", down.Version, err)
+			return err
 		}
-		if _, err := m.Conn.ExecContext(ctx, expanded); err != nil {
-			return fmt.Errorf("apply down %d failed: %w", down.Version, err)
+		start := m.started(ctx, down)
+		if txc, ok := m.txConn(down); ok {
+			err = m.inTx(ctx, txc, down, func(c dialect.Conn) error {
+				if err := m.runMigration(ctx, c, down, expanded, true); err != nil {
+					return err
+				}
+				return m.Dialect.DeleteVersion(ctx, c, m.Schema, down.Version)
+			})
+		} else {
+			err = m.applyDownDirty(ctx, applied[down.Version], down, expanded)
 		}
-		if err := m.Dialect.DeleteVersion(ctx, m.Conn, m.Schema, down.Version); err != nil {
-			return err
+		if err != nil {
+			m.failed(ctx, down, start, err)
+			return m.migrationFailed(ctx, down, time.Since(start), err)
 		}
+		m.finished(ctx, down, start)
+		m.recorded(down)
 	}
 	return nil
 }
 
+// logPlan reports the migrations a run is about to apply.
+func (m *Migrator) logPlan(ctx context.Context, downs, ups []MigrationFile) {
+	labels := make([]string, 0, len(downs)+len(ups))
+	for _, f := range append(append([]MigrationFile{}, downs...), ups...) {
+		labels = append(labels, f.Direction+" "+f.Label())
+	}
+	m.log(ctx, slog.LevelInfo, "plan computed", slog.Int("downs", len(downs)), slog.Int("ups", len(ups)), slog.Any("migrations", labels))
+}
+
+func (m *Migrator) started(ctx context.Context, f MigrationFile) time.Time {
+	_, tx := m.txConn(f)
+	m.log(ctx, slog.LevelInfo, "migration started", append(fileAttrs(f), slog.Bool("transaction", tx))...)
+	return time.Now()
+}
+
+func (m *Migrator) finished(ctx context.Context, f MigrationFile, start time.Time) {
+	m.log(ctx, slog.LevelInfo, "migration finished", append(fileAttrs(f), slog.Duration("duration", time.Since(start)))...)
+}
+
+// recorded tells a dry run that the statements of f, a migration or a run-level
+// SQL hook, are complete.
+func (m *Migrator) recorded(f MigrationFile) {
+	if m.recorder != nil {
+		m.recorder(f)
+	}
+}
+
+func (m *Migrator) failed(ctx context.Context, f MigrationFile, start time.Time, err error) {
+	m.log(ctx, slog.LevelError, "migration failed", append(fileAttrs(f), slog.Duration("duration", time.Since(start)), slog.String("error", err.Error()))...)
+}
+
+func fileAttrs(f MigrationFile) []slog.Attr {
+	return []slog.Attr{slog.String("version", f.Label()), slog.String("name", f.Name), slog.String("direction", f.Direction)}
+}
+
+func (m *Migrator) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if m.Log != nil {
+		m.Log.LogAttrs(ctx, level, msg, attrs...)
+	}
+}
+
+// PlanTo returns the migrations that leave target as the highest applied version:
+// the applied versions above target in reverse order, then the pending ups up to target.
+// Target 0 reverts everything. It fails if target is not a known version or if an
+// applied version above target has no down file.
+func PlanTo(pairs []MigrationPair, applied map[int64]dialect.AppliedMigration, target int64) (downs, ups []MigrationFile, err error) {
+	known := target == 0
+	hasDown := map[int64]bool{}
+	for _, p := range pairs {
+		if p.Up != nil && p.Up.Version == target {
+			known = true
+		}
+		if p.Down != nil {
+			hasDown[p.Down.Version] = true
+		}
+	}
+	if _, ok := applied[target]; ok {
+		known = true
+	}
+	if !known {
+		return nil, nil, fmt.Errorf("unknown target version %d", target)
+	}
+	var missing []string
+	for _, v := range sortedVersions(applied) {
+		if v > target && !hasDown[v] {
+			missing = append(missing, fmt.Sprintf("%04d", v))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("cannot migrate down to %d: no down migration for version(s) %s", target, strings.Join(missing, ", "))
+	}
+	for _, down := range ReverseForDown(pairs, applied, 0) {
+		if down.Version > target {
+			downs = append(downs, down)
+		}
+	}
+	for _, up := range FilterPending(pairs, applied) {
+		if up.Version <= target {
+			ups = append(ups, up)
+		}
+	}
+	return downs, ups, nil
+}
+
+// WithRepeatables appends due to ups if ups leaves no versioned migration of pairs
+// pending, so repeatable migrations always run last, against the latest schema.
+func WithRepeatables(pairs []MigrationPair, applied map[int64]dialect.AppliedMigration, ups, due []MigrationFile) []MigrationFile {
+	if len(ups) < len(FilterPending(pairs, applied)) {
+		return ups
+	}
+	return append(ups, due...)
+}
+
+// MigrateTo migrates up or down so that target becomes the highest applied version
+// and returns the migrations it ran, downs first. An up-only plan that leaves nothing
+// pending also runs the due repeatable migrations. Nothing runs if PlanTo fails.
+func (m *Migrator) MigrateTo(ctx context.Context, pairs []MigrationPair, target int64) ([]MigrationFile, error) {
+	applied, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	downs, ups, err := PlanTo(pairs, applied, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(downs) == 0 {
+		due, err := m.DueRepeatables(pairs, applied)
+		if err != nil {
+			return nil, err
+		}
+		ups = WithRepeatables(pairs, applied, ups, due)
+	}
+	if err := m.ApplyPlan(ctx, downs, ups); err != nil {
+		return nil, err
+	}
+	return append(downs, ups...), nil
+}
+
+// applyDownDirty runs a down migration without a transaction, marking the applied row
+// dirty until the SQL succeeds and the row is deleted.
+func (m *Migrator) applyDownDirty(ctx context.Context, rec dialect.AppliedMigration, down MigrationFile, expanded string) error {
+	rec.Version = down.Version
+	rec.Dirty = true
+	if err := m.Dialect.UpdateVersion(ctx, m.Conn, m.Schema, rec); err != nil {
+		return fmt.Errorf("mark %d dirty: %w", down.Version, err)
+	}
+	if err := m.runMigration(ctx, m.Conn, down, expanded, false); err != nil {
+		return m.recordFailure(ctx, rec, err)
+	}
+	return m.Dialect.DeleteVersion(ctx, m.Conn, m.Schema, down.Version)
+}
+
+// txConn returns the connection to begin a transaction on if f should run in one:
+// the dialect supports transactional DDL, the connection can begin transactions and
+// f does not opt out with a "-- scima:no-transaction" directive.
+func (m *Migrator) txConn(f MigrationFile) (dialect.TxConn, bool) {
+	txc, ok := m.Conn.(dialect.TxConn)
+	if !ok || f.NoTransaction || !m.Dialect.SupportsTransactionalDDL() {
+		return nil, false
+	}
+	return txc, true
+}
+
+// inTx runs fn in a transaction on txc, rolling back if fn fails.
+func (m *Migrator) inTx(ctx context.Context, txc dialect.TxConn, f MigrationFile, fn func(c dialect.Conn) error) error {
+	tx, err := txc.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction for %d: %w", f.Version, err)
+	}
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit %d: %w", f.Version, err)
+	}
+	return nil
+}
+
+// Force records version as cleanly applied (applied=true) or removes it from the
+// tracking table (applied=false) after a failed migration has been repaired by hand.
+// The recorded name and checksum come from the matching up file in pairs, if any.
+func (m *Migrator) Force(ctx context.Context, pairs []MigrationPair, version int64, applied bool) error {
+	current, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	rec, exists := current[version]
+	if !applied {
+		if !exists {
+			return nil
+		}
+		return m.Dialect.DeleteVersion(ctx, m.Conn, m.Schema, version)
+	}
+	up := MigrationFile{Version: version, Name: rec.Name}
+	checksum := ""
+	for _, p := range pairs {
+		if p.Up == nil || p.Up.Version != version {
+			continue
+		}
+		up = *p.Up
+		expanded, err := fileSQL(up, m.Dialect, m.Schema)
+		if err != nil {
+			return err
+		}
+		checksum = checksumOf(up, expanded)
+	}
+	forced := m.record(up, checksum, time.Now())
+	forced.Duration = 0
+	if exists {
+		return m.Dialect.UpdateVersion(ctx, m.Conn, m.Schema, forced)
+	}
+	return m.Dialect.InsertVersion(ctx, m.Conn, m.Schema, forced)
+}
+
 const (
 	requiredSchemaToken = "{{schema}}"
 	optionalSchemaToken = "{{schema?}}"
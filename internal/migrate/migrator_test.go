@@ -2,7 +2,10 @@ package migrate
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/scima/scima/internal/dialect"
 )
@@ -58,39 +61,338 @@ func (r mockRows) Err() error   { return nil }
 
 // mock dialect
 
-type mockDialect struct{ versions map[int64]bool }
+type mockDialect struct {
+	applied       map[int64]dialect.AppliedMigration
+	transactional bool
+	lock          *mockLock
+}
+
+type mockLock struct {
+	held    bool
+	lockErr error
+}
 
-func (d mockDialect) Name() string { return "mock" }
+func (d mockDialect) Name() string                      { return "mock" }
+func (d mockDialect) SupportsTransactionalDDL() bool    { return d.transactional }
+func (d mockDialect) CheckStatement(string, bool) error { return nil }
 func (d mockDialect) EnsureMigrationTable(_ context.Context, _ dialect.Conn, _ string) error {
 	return nil
 }
-func (d mockDialect) SelectAppliedVersions(_ context.Context, _ dialect.Conn, _ string) (map[int64]bool, error) {
-	return d.versions, nil
+func (d mockDialect) MigrationTableExists(context.Context, dialect.Conn, string) (bool, error) {
+	return true, nil
+}
+func (d mockDialect) SelectApplied(_ context.Context, _ dialect.Conn, _ string) ([]dialect.AppliedMigration, error) {
+	var res []dialect.AppliedMigration
+	for _, m := range d.applied {
+		res = append(res, m)
+	}
+	return res, nil
+}
+func (d mockDialect) InsertVersion(_ context.Context, _ dialect.Conn, _ string, m dialect.AppliedMigration) error {
+	d.applied[m.Version] = m
+	return nil
 }
-func (d mockDialect) InsertVersion(_ context.Context, _ dialect.Conn, _ string, version int64) error {
-	d.versions[version] = true
+func (d mockDialect) DescribeError(error) dialect.ErrorDetails { return dialect.ErrorDetails{} }
+func (d mockDialect) UpdateVersion(_ context.Context, _ dialect.Conn, _ string, m dialect.AppliedMigration) error {
+	d.applied[m.Version] = m
 	return nil
 }
 func (d mockDialect) DeleteVersion(_ context.Context, _ dialect.Conn, _ string, version int64) error {
-	delete(d.versions, version)
+	delete(d.applied, version)
+	return nil
+}
+func (d mockDialect) Lock(_ context.Context, _ dialect.Conn, _ string, _ time.Duration) error {
+	if d.lock.lockErr != nil {
+		return d.lock.lockErr
+	}
+	d.lock.held = true
+	return nil
+}
+func (d mockDialect) Unlock(_ context.Context, _ dialect.Conn, _ string) error {
+	d.lock.held = false
 	return nil
 }
+func (d mockDialect) ForceUnlock(ctx context.Context, c dialect.Conn, schema string) error {
+	return d.Unlock(ctx, c, schema)
+}
 
 func TestMigratorApplyUpDown(t *testing.T) {
-	versions := map[int64]bool{10: true}
-	migr := NewMigrator(mockDialect{versions: versions}, &mockConn{Versions: versions}, "")
+	applied := map[int64]dialect.AppliedMigration{10: {Version: 10}}
+	migr := NewMigrator(mockDialect{applied: applied}, &mockConn{}, "")
 	ups := []MigrationFile{{Version: 20, Name: "add_col", Direction: "up", SQL: "ALTER"}}
 	if err := migr.ApplyUp(context.Background(), ups); err != nil {
 		t.Fatalf("apply up: %v", err)
 	}
-	if !versions[20] {
+	rec, ok := applied[20]
+	if !ok {
 		t.Fatalf("version 20 not inserted")
 	}
+	if rec.Name != "add_col" || rec.AppliedAt.IsZero() || rec.ScimaVersion == "" {
+		t.Fatalf("history row incomplete: %+v", rec)
+	}
 	downs := []MigrationFile{{Version: 20, Name: "add_col", Direction: "down", SQL: "ALTER"}}
 	if err := migr.ApplyDown(context.Background(), downs); err != nil {
 		t.Fatalf("apply down: %v", err)
 	}
-	if versions[20] {
+	if _, ok := applied[20]; ok {
 		t.Fatalf("version 20 still present")
 	}
 }
+
+func TestMigratorHistoryOrder(t *testing.T) {
+	now := time.Now()
+	applied := map[int64]dialect.AppliedMigration{
+		10: {Version: 10, AppliedAt: now},
+		20: {Version: 20, AppliedAt: now.Add(-time.Hour)},
+	}
+	migr := NewMigrator(mockDialect{applied: applied}, &mockConn{}, "")
+	rows, err := migr.History(context.Background())
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Version != 20 || rows[1].Version != 10 {
+		t.Fatalf("history not ordered by applied_at: %+v", rows)
+	}
+}
+
+func TestMigratorVerifyDetectsDrift(t *testing.T) {
+	applied := map[int64]dialect.AppliedMigration{}
+	migr := NewMigrator(mockDialect{applied: applied}, &mockConn{}, "tenant1")
+	up := &MigrationFile{Version: 10, Name: "init", Direction: "up", SQL: "CREATE TABLE {{schema}}.t (id INT);"}
+	if err := migr.ApplyUp(context.Background(), []MigrationFile{*up}); err != nil {
+		t.Fatalf("apply up: %v", err)
+	}
+	if applied[10].Checksum != Checksum("CREATE TABLE tenant1.t (id INT);") {
+		t.Fatalf("checksum of expanded sql not recorded: %q", applied[10].Checksum)
+	}
+	pairs := []MigrationPair{{Up: up}}
+	mismatches, err := migr.Verify(context.Background(), pairs)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Fatalf("unexpected mismatches: %+v", mismatches)
+	}
+	up.SQL = "CREATE TABLE {{schema}}.t (id BIGINT);"
+	mismatches, err = migr.Verify(context.Background(), pairs)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(mismatches) != 1 || mismatches[0].Version != 10 {
+		t.Fatalf("expected drift for version 10, got %+v", mismatches)
+	}
+	// Legacy rows without a checksum are not reported.
+	applied[10] = dialect.AppliedMigration{Version: 10}
+	mismatches, err = migr.Verify(context.Background(), pairs)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Fatalf("legacy row reported as drift: %+v", mismatches)
+	}
+}
+
+// txConn is a mockConn that supports transactions and fails statements equal to failOn.
+type txConn struct {
+	mockConn
+	failOn    string
+	begun     int
+	committed int
+	rolled    int
+}
+
+func (c *txConn) ExecContext(ctx context.Context, query string, args ...any) (dialect.Result, error) {
+	if query == c.failOn {
+		return nil, errors.New("boom")
+	}
+	return c.mockConn.ExecContext(ctx, query, args...)
+}
+
+func (c *txConn) BeginTx(_ context.Context) (dialect.Tx, error) {
+	c.begun++
+	return mockTx{c}, nil
+}
+
+type mockTx struct{ *txConn }
+
+func (t mockTx) Commit() error   { t.committed++; return nil }
+func (t mockTx) Rollback() error { t.rolled++; return nil }
+
+func TestMigratorApplyUpTransactional(t *testing.T) {
+	applied := map[int64]dialect.AppliedMigration{}
+	conn := &txConn{failOn: "BROKEN"}
+	migr := NewMigrator(mockDialect{applied: applied, transactional: true}, conn, "")
+	ups := []MigrationFile{
+		{Version: 10, Name: "ok", Direction: "up", SQL: "CREATE"},
+		{Version: 20, Name: "concurrently", Direction: "up", SQL: "CREATE INDEX CONCURRENTLY", NoTransaction: true},
+		{Version: 30, Name: "broken", Direction: "up", SQL: "BROKEN"},
+	}
+	if err := migr.ApplyUp(context.Background(), ups); err == nil {
+		t.Fatalf("expected error from broken migration")
+	}
+	if conn.begun != 2 || conn.committed != 1 || conn.rolled != 1 {
+		t.Fatalf("unexpected tx usage: begun=%d committed=%d rolled=%d", conn.begun, conn.committed, conn.rolled)
+	}
+	if _, ok := applied[20]; !ok {
+		t.Fatalf("no-transaction migration not recorded")
+	}
+}
+
+func TestMigratorApplyUpNonTransactionalDialect(t *testing.T) {
+	conn := &txConn{}
+	migr := NewMigrator(mockDialect{applied: map[int64]dialect.AppliedMigration{}}, conn, "")
+	if err := migr.ApplyUp(context.Background(), []MigrationFile{{Version: 10, Direction: "up", SQL: "CREATE"}}); err != nil {
+		t.Fatalf("apply up: %v", err)
+	}
+	if conn.begun != 0 {
+		t.Fatalf("transaction used for non-transactional dialect")
+	}
+}
+
+func TestMigratorWithLock(t *testing.T) {
+	lock := &mockLock{}
+	migr := NewMigrator(mockDialect{lock: lock}, &mockConn{}, "")
+	err := migr.WithLock(context.Background(), func(_ context.Context) error {
+		if !lock.held {
+			t.Fatalf("lock not held inside WithLock")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("with lock: %v", err)
+	}
+	if lock.held {
+		t.Fatalf("lock not released")
+	}
+	lock.lockErr = dialect.ErrLockTimeout
+	called := false
+	err = migr.WithLock(context.Background(), func(_ context.Context) error { called = true; return nil })
+	if !errors.Is(err, dialect.ErrLockTimeout) || called {
+		t.Fatalf("expected lock timeout without running fn, got err=%v called=%v", err, called)
+	}
+}
+
+func TestMigratorDirtyStateAndForce(t *testing.T) {
+	applied := map[int64]dialect.AppliedMigration{}
+	conn := &txConn{failOn: "BROKEN"}
+	migr := NewMigrator(mockDialect{applied: applied}, conn, "")
+	broken := MigrationFile{Version: 10, Name: "broken", Direction: "up", SQL: "BROKEN"}
+	if err := migr.ApplyUp(context.Background(), []MigrationFile{broken}); err == nil {
+		t.Fatalf("expected failure")
+	}
+	rec := applied[10]
+	if !rec.Dirty || !strings.Contains(rec.Error, "boom") {
+		t.Fatalf("failed migration not marked dirty: %+v", rec)
+	}
+	if !strings.Contains(PrettyPrint([]MigrationPair{{Up: &broken}}, applied, nil, nil), "DIRTY: ") {
+		t.Fatalf("status does not show dirty version")
+	}
+	next := MigrationFile{Version: 20, Name: "next", Direction: "up", SQL: "CREATE"}
+	if err := migr.ApplyUp(context.Background(), []MigrationFile{next}); !errors.Is(err, ErrDirty) {
+		t.Fatalf("expected ErrDirty, got %v", err)
+	}
+	if err := migr.ApplyDown(context.Background(), []MigrationFile{{Version: 10, Direction: "down", SQL: "DROP"}}); !errors.Is(err, ErrDirty) {
+		t.Fatalf("expected ErrDirty for down, got %v", err)
+	}
+	if err := migr.Force(context.Background(), []MigrationPair{{Up: &broken}}, 10, true); err != nil {
+		t.Fatalf("force: %v", err)
+	}
+	if rec := applied[10]; rec.Dirty || rec.Error != "" || rec.Checksum != Checksum("BROKEN") {
+		t.Fatalf("force did not record a clean row: %+v", rec)
+	}
+	if err := migr.ApplyUp(context.Background(), []MigrationFile{next}); err != nil {
+		t.Fatalf("apply after force: %v", err)
+	}
+	if err := migr.Force(context.Background(), nil, 20, false); err != nil {
+		t.Fatalf("force pending: %v", err)
+	}
+	if _, ok := applied[20]; ok {
+		t.Fatalf("force pending kept the row")
+	}
+}
+
+func TestMigratorExecutesStatementsSeparately(t *testing.T) {
+	conn := &txConn{failOn: "BROKEN"}
+	migr := NewMigrator(mockDialect{applied: map[int64]dialect.AppliedMigration{}}, conn, "")
+	up := MigrationFile{Version: 10, Direction: "up", SQL: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\nBROKEN;"}
+	err := migr.ApplyUp(context.Background(), []MigrationFile{up})
+	var me *MigrationError
+	if !errors.As(err, &me) || me.StatementIndex != 3 || me.Line != 3 || me.Statement != "BROKEN" {
+		t.Fatalf("expected migration error for statement 3, got %v", err)
+	}
+	if len(conn.Execs) != 2 || conn.Execs[1] != "CREATE TABLE b (id INT)" {
+		t.Fatalf("statements not executed one by one: %q", conn.Execs)
+	}
+}
+
+func TestMigratorOutOfOrderPolicy(t *testing.T) {
+	applied := map[int64]dialect.AppliedMigration{20250102000000: {Version: 20250102000000}}
+	migr := NewMigrator(mockDialect{applied: applied}, &mockConn{}, "")
+	late := MigrationFile{Version: 20250101000000, Name: "late_branch", Direction: "up", SQL: "SELECT 1"}
+	next := MigrationFile{Version: 20250103000000, Name: "next", Direction: "up", SQL: "SELECT 1"}
+
+	err := migr.ApplyUp(context.Background(), []MigrationFile{late, next})
+	var ooe *OutOfOrderError
+	if !errors.As(err, &ooe) || len(ooe.Versions) != 1 || ooe.Versions[0] != late.Version {
+		t.Fatalf("expected out of order error for %d, got %v", late.Version, err)
+	}
+	if len(applied) != 1 {
+		t.Fatalf("nothing should be applied when refusing: %v", applied)
+	}
+
+	migr.AllowOutOfOrder = true
+	if err := migr.ApplyUp(context.Background(), []MigrationFile{late, next}); err != nil {
+		t.Fatalf("apply with out of order allowed: %v", err)
+	}
+	if !applied[late.Version].OutOfOrder || applied[next.Version].OutOfOrder {
+		t.Fatalf("out of order flag wrong: %+v", applied)
+	}
+	pairs := []MigrationPair{{Up: &late}, {Up: &next}}
+	if status := PrettyPrint(pairs, applied, nil, nil); !strings.Contains(status, "late_branch\tapplied (out of order)") {
+		t.Fatalf("status does not flag out of order row:\n%s", status)
+	}
+}
+
+func TestPlanTo(t *testing.T) {
+	file := func(v int64, dir string) *MigrationFile {
+		return &MigrationFile{Version: v, Name: "m", Direction: dir, SQL: "SELECT 1"}
+	}
+	pairs := []MigrationPair{
+		{Up: file(10, "up"), Down: file(10, "down")},
+		{Up: file(20, "up"), Down: file(20, "down")},
+		{Up: file(30, "up")},
+		{Up: file(40, "up"), Down: file(40, "down")},
+	}
+	applied := map[int64]dialect.AppliedMigration{10: {Version: 10}, 20: {Version: 20}}
+
+	downs, ups, err := PlanTo(pairs, applied, 40)
+	if err != nil || len(downs) != 0 || len(ups) != 2 || ups[0].Version != 30 || ups[1].Version != 40 {
+		t.Fatalf("plan up: %v %v %v", downs, ups, err)
+	}
+	downs, ups, err = PlanTo(pairs, applied, 10)
+	if err != nil || len(ups) != 0 || len(downs) != 1 || downs[0].Version != 20 {
+		t.Fatalf("plan down: %v %v %v", downs, ups, err)
+	}
+	if _, _, err := PlanTo(pairs, applied, 25); err == nil || !strings.Contains(err.Error(), "unknown target version 25") {
+		t.Fatalf("expected unknown target error, got %v", err)
+	}
+	applied[30] = dialect.AppliedMigration{Version: 30}
+	if _, _, err := PlanTo(pairs, applied, 0); err == nil || !strings.Contains(err.Error(), "no down migration for version(s) 0030") {
+		t.Fatalf("expected missing down error, got %v", err)
+	}
+
+	migr := NewMigrator(mockDialect{applied: applied}, &mockConn{}, "")
+	ran, err := migr.MigrateTo(context.Background(), pairs, 40)
+	if err != nil || len(ran) != 1 || ran[0].Version != 40 {
+		t.Fatalf("migrate to 40: %v %v", ran, err)
+	}
+	if _, ok := applied[40]; !ok {
+		t.Fatalf("version 40 not applied")
+	}
+	if _, err := migr.MigrateTo(context.Background(), pairs, 0); err == nil {
+		t.Fatalf("expected missing down error")
+	}
+	if _, ok := applied[10]; !ok {
+		t.Fatalf("nothing may be reverted when the plan fails")
+	}
+}
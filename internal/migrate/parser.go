@@ -1,16 +1,27 @@
 package migrate
 
 import (
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/scima/scima/internal/dialect"
 )
 
-var filePattern = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_]+)\.(up|down)\.sql$`)
+// filePattern matches SQL migrations such as 0020_add_email.up.sql, optionally with a
+// dialect variant before the extension: 0020_add_email.up.postgres.sql.
+var filePattern = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_]+)\.(up|down)(?:\.([a-z][a-z0-9]*))?\.sql$`)
+
+// repeatablePattern matches repeatable migrations such as R__refresh_views.sql.
+var repeatablePattern = regexp.MustCompile(`^R__([a-zA-Z0-9_]+)\.sql$`)
 
 // MigrationFile represents a single migration direction (up or down)
 type MigrationFile struct {
@@ -19,6 +30,59 @@ type MigrationFile struct {
 	Direction string // up or down
 	FullPath  string
 	SQL       string
+	// NoTransaction is set by a "-- scima:no-transaction" header directive.
+	NoTransaction bool
+	// Repeatable marks an R__<name>.sql file, applied again whenever it changes.
+	// Its Version is RepeatableVersion(Name).
+	Repeatable bool
+	// Operations are set for declarative (YAML) migrations, which have no SQL until
+	// rendered for a dialect.
+	Operations []dialect.Operation
+	// Dialect names the dialect of a variant file such as 0020_add_email.up.postgres.sql;
+	// it is empty for generic files.
+	Dialect string
+	// Exec is set for migrations written in Go, which have no SQL; see MergeExecutables.
+	Exec ExecutableMigration
+}
+
+// Label identifies f in output: its zero padded version, or "R" for a repeatable migration.
+func (f MigrationFile) Label() string {
+	if f.Repeatable {
+		return "R"
+	}
+	return fmt.Sprintf("%04d", f.Version)
+}
+
+// RepeatableVersion returns the negative version under which a repeatable migration
+// is tracked. Versioned migrations are never negative, so both share the tracking table.
+func RepeatableVersion(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	v := int64(h.Sum64() >> 1)
+	if v == 0 {
+		v = 1
+	}
+	return -v
+}
+
+const noTransactionDirective = "scima:no-transaction"
+
+// hasHeaderDirective reports whether directive appears as a "--" comment
+// before the first SQL statement of a file.
+func hasHeaderDirective(sql, directive string) bool {
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			return false
+		}
+		if strings.TrimSpace(strings.TrimPrefix(line, "--")) == directive {
+			return true
+		}
+	}
+	return false
 }
 
 // MigrationPair groups up/down
@@ -26,19 +90,86 @@ type MigrationFile struct {
 type MigrationPair struct {
 	Up   *MigrationFile
 	Down *MigrationFile
+
+	// problems found while picking the files of the pair, reported by Validate.
+	problems []string
 }
 
-// ScanDir scans for migrations under directory.
-func ScanDir(dir string) ([]MigrationPair, error) {
-	entries, err := os.ReadDir(dir)
+// ScanDir scans for migrations under directory. Versioned migrations, SQL or declarative
+// YAML, come first in version order, followed by repeatable ones in name order, each
+// as a pair without Down.
+//
+// A dialect variant such as 0020_add_email.up.postgres.sql replaces the generic
+// 0020_add_email.up.sql (or YAML file) when dialectName is "postgres"; variants for
+// other dialects are ignored. With an empty dialectName, generic files are preferred
+// and otherwise any variant is taken, which is enough to find the versions in use.
+func ScanDir(dir, dialectName string) ([]MigrationPair, error) {
+	return scan(os.DirFS(dir), ".", dialectName, func(name string) string { return filepath.Join(dir, name) })
+}
+
+// ScanFS scans for migrations in directory dir of fsys ("." for its root), e.g. an
+// embed.FS, a zip archive or an fstest.MapFS. FullPath is the slash separated path in
+// fsys. Dialect variants are picked as in ScanDir.
+func ScanFS(fsys fs.FS, dir, dialectName string) ([]MigrationPair, error) {
+	return scan(fsys, dir, dialectName, func(name string) string { return path.Join(dir, name) })
+}
+
+// candidates collects the files that may serve as the up or down file of a version.
+type candidates struct {
+	up, down []*MigrationFile
+	ignored  []string // variants for other dialects
+}
+
+// scan reads the migrations in dir of fsys; fullPath renders a file name for MigrationFile.FullPath.
+func scan(fsys fs.FS, dir, dialectName string, fullPath func(name string) string) ([]MigrationPair, error) {
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("read migrations %s: %w", fullPath(""), err)
 	}
-	byVersion := map[int64]*MigrationPair{}
+	byVersion := map[int64]*candidates{}
+	candidatesFor := func(version int64) *candidates {
+		c := byVersion[version]
+		if c == nil {
+			c = &candidates{}
+			byVersion[version] = c
+		}
+		return c
+	}
+	var repeatables []MigrationPair
 	for _, e := range entries {
 		if e.IsDir() {
 			continue
 		}
+		if r := repeatablePattern.FindStringSubmatch(e.Name()); r != nil {
+			contentBytes, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			sql := string(contentBytes)
+			mf := &MigrationFile{Version: RepeatableVersion(r[1]), Name: r[1], Direction: "up", FullPath: fullPath(e.Name()), SQL: sql, NoTransaction: hasHeaderDirective(sql, noTransactionDirective), Repeatable: true}
+			repeatables = append(repeatables, MigrationPair{Up: mf})
+			continue
+		}
+		if d := declarativePattern.FindStringSubmatch(e.Name()); d != nil {
+			version, err := strconv.ParseInt(d[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version in filename %s: %w", e.Name(), err)
+			}
+			content, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			up, down, err := parseDeclarative(version, d[2], fullPath(e.Name()), content)
+			if err != nil {
+				return nil, err
+			}
+			c := candidatesFor(version)
+			c.up = append(c.up, up)
+			if down != nil {
+				c.down = append(c.down, down)
+			}
+			continue
+		}
 		m := filePattern.FindStringSubmatch(e.Name())
 		if m == nil {
 			continue
@@ -46,49 +177,104 @@ func ScanDir(dir string) ([]MigrationPair, error) {
 		versionStr := m[1]
 		name := m[2]
 		dirn := m[3]
+		variant := m[4]
 		version, err := strconv.ParseInt(versionStr, 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid version in filename %s: %w", e.Name(), err)
 		}
-		path := filepath.Join(dir, e.Name())
-		contentBytes, err := os.ReadFile(path)
+		c := candidatesFor(version)
+		if variant != "" && dialectName != "" && variant != dialectName {
+			c.ignored = append(c.ignored, e.Name())
+			continue
+		}
+		contentBytes, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
 		if err != nil {
 			return nil, err
 		}
-		mf := &MigrationFile{Version: version, Name: name, Direction: dirn, FullPath: path, SQL: string(contentBytes)}
-		pair := byVersion[version]
-		if pair == nil {
-			pair = &MigrationPair{}
-			byVersion[version] = pair
-		}
+		sql := string(contentBytes)
+		mf := &MigrationFile{Version: version, Name: name, Direction: dirn, FullPath: fullPath(e.Name()), SQL: sql, NoTransaction: hasHeaderDirective(sql, noTransactionDirective), Dialect: variant}
 		if dirn == "up" {
-			pair.Up = mf
+			c.up = append(c.up, mf)
 		} else {
-			pair.Down = mf
+			c.down = append(c.down, mf)
 		}
 	}
 	// sort
-	versions := make([]int, 0, len(byVersion))
+	versions := make([]int64, 0, len(byVersion))
 	for v := range byVersion {
-		versions = append(versions, int(v))
+		versions = append(versions, v)
 	}
-	sort.Ints(versions)
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
 	pairs := make([]MigrationPair, 0, len(versions))
 	for _, v := range versions {
-		pair := byVersion[int64(v)]
-		pairs = append(pairs, *pair)
+		c := byVersion[v]
+		var pair MigrationPair
+		pair.Up = pickVariant(&pair, v, "up", c.up, dialectName)
+		pair.Down = pickVariant(&pair, v, "down", c.down, dialectName)
+		if pair.Up == nil && len(c.ignored) > 0 {
+			pair.problems = append(pair.problems, fmt.Sprintf("version %d has no up file for dialect %s, only %s", v, dialectName, strings.Join(c.ignored, ", ")))
+		}
+		if pair.Up != nil || pair.Down != nil || len(pair.problems) > 0 {
+			pairs = append(pairs, pair)
+		}
+	}
+	// fs.ReadDir returns entries sorted by name, so repeatables already are.
+	seen := map[int64]string{}
+	for _, r := range repeatables {
+		if other, ok := seen[r.Up.Version]; ok {
+			return nil, fmt.Errorf("repeatable migrations %s and %s hash to the same tracking version; rename one", other, r.Up.Name)
+		}
+		seen[r.Up.Version] = r.Up.Name
+	}
+	return append(pairs, repeatables...), nil
+}
+
+// pickVariant returns the file among files to use for dialectName: its variant if
+// there is one, otherwise the generic file. With an empty dialectName, a variant
+// stands in when there is no generic file. Several files of the same kind are a
+// problem recorded on pair; the first one is returned so scanning can go on.
+func pickVariant(pair *MigrationPair, version int64, direction string, files []*MigrationFile, dialectName string) *MigrationFile {
+	var variants, generic []*MigrationFile
+	for _, f := range files {
+		if f.Dialect == "" {
+			generic = append(generic, f)
+		} else {
+			variants = append(variants, f)
+		}
+	}
+	chosen := generic
+	switch {
+	case dialectName != "" && len(variants) > 0:
+		chosen = variants
+	case dialectName == "" && len(generic) == 0 && len(variants) > 0:
+		return variants[0]
+	}
+	if len(chosen) == 0 {
+		return nil
+	}
+	if len(chosen) > 1 {
+		names := make([]string, len(chosen))
+		for i, f := range chosen {
+			names[i] = filepath.Base(f.FullPath)
+		}
+		kind := "generic " + direction
+		if chosen[0].Dialect != "" {
+			kind = chosen[0].Dialect + " " + direction
+		}
+		pair.problems = append(pair.problems, fmt.Sprintf("version %d has %d %s files, expected one: %s", version, len(chosen), kind, strings.Join(names, ", ")))
 	}
-	return pairs, nil
+	return chosen[0]
 }
 
-// FilterPending calculates pending ups given applied versions.
-func FilterPending(pairs []MigrationPair, applied map[int64]bool) []MigrationFile {
+// FilterPending calculates pending versioned ups given applied versions.
+// Repeatable migrations are selected by (*Migrator).DueRepeatables instead.
+func FilterPending(pairs []MigrationPair, applied map[int64]dialect.AppliedMigration) []MigrationFile {
 	var res []MigrationFile
 	for _, p := range pairs {
-		if p.Up == nil {
+		if p.Up == nil || p.Up.Repeatable {
 			continue
 		}
-		if !applied[p.Up.Version] {
+		if _, ok := applied[p.Up.Version]; !ok {
 			res = append(res, *p.Up)
 		}
 	}
@@ -96,13 +282,13 @@ func FilterPending(pairs []MigrationPair, applied map[int64]bool) []MigrationFil
 }
 
 // ReverseForDown returns downs in reverse order restricted to already applied versions.
-func ReverseForDown(pairs []MigrationPair, applied map[int64]bool, steps int) []MigrationFile {
+func ReverseForDown(pairs []MigrationPair, applied map[int64]dialect.AppliedMigration, steps int) []MigrationFile {
 	var downs []MigrationFile
 	for _, p := range pairs {
 		if p.Down == nil {
 			continue
 		}
-		if applied[p.Down.Version] {
+		if _, ok := applied[p.Down.Version]; ok {
 			downs = append(downs, *p.Down)
 		}
 	}
@@ -116,9 +302,13 @@ func ReverseForDown(pairs []MigrationPair, applied map[int64]bool, steps int) []
 	return downs
 }
 
-// Validate ensures each pair has an up file.
+// Validate ensures each pair resolved to exactly one up file, and at most one down
+// file, for the dialect it was scanned for.
 func Validate(pairs []MigrationPair) error {
 	for _, p := range pairs {
+		if len(p.problems) > 0 {
+			return errors.New(p.problems[0])
+		}
 		if p.Up == nil {
 			return fmt.Errorf("missing up migration for version %d", p.Down.Version)
 		}
@@ -131,7 +321,20 @@ func Validate(pairs []MigrationPair) error {
 }
 
 // PrettyPrint builds status output lines.
-func PrettyPrint(pairs []MigrationPair, applied map[int64]bool) string {
+// Applied versions listed in mismatches are reported as modified, and pending versions
+// older than the highest applied one as out of order. Dialect variants are marked
+// with their dialect after the name. Repeatable migrations are
+// "changed" if listed in due and "up to date" otherwise, once applied.
+func PrettyPrint(pairs []MigrationPair, applied map[int64]dialect.AppliedMigration, mismatches []ChecksumMismatch, due []MigrationFile) string {
+	modified := map[int64]bool{}
+	for _, mm := range mismatches {
+		modified[mm.Version] = true
+	}
+	changed := map[int64]bool{}
+	for _, f := range due {
+		changed[f.Version] = true
+	}
+	highest := maxVersion(applied)
 	var sb strings.Builder
 	for _, p := range pairs {
 		up := p.Up
@@ -139,10 +342,31 @@ func PrettyPrint(pairs []MigrationPair, applied map[int64]bool) string {
 			continue
 		}
 		status := "pending"
-		if applied[up.Version] {
-			status = "applied"
+		if !up.Repeatable && up.Version < highest {
+			status = fmt.Sprintf("pending (out of order: older than applied %04d)", highest)
+		}
+		if rec, ok := applied[up.Version]; ok {
+			switch {
+			case up.Repeatable && changed[up.Version]:
+				status = "changed"
+			case up.Repeatable:
+				status = "up to date"
+			case modified[up.Version]:
+				status = "applied (checksum mismatch)"
+			case rec.OutOfOrder:
+				status = "applied (out of order)"
+			default:
+				status = "applied"
+			}
+			if rec.Dirty {
+				status = "DIRTY: " + rec.Error
+			}
+		}
+		name := up.Name
+		if up.Dialect != "" {
+			name += " [" + up.Dialect + "]"
 		}
-		fmt.Fprintf(&sb, "%04d\t%s\t%s\n", up.Version, up.Name, status)
+		fmt.Fprintf(&sb, "%s\t%s\t%s\n", up.Label(), name, status)
 	}
 	return sb.String()
 }
@@ -3,7 +3,11 @@ package migrate
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+
+	"github.com/scima/scima/internal/dialect"
 )
 
 func TestScanDirAndValidate(t *testing.T) {
@@ -18,7 +22,7 @@ func TestScanDirAndValidate(t *testing.T) {
 			t.Fatal(err)
 		}
 	}
-	pairs, err := ScanDir(dir)
+	pairs, err := ScanDir(dir, "")
 	if err != nil {
 		t.Fatalf("scan error: %v", err)
 	}
@@ -28,7 +32,7 @@ func TestScanDirAndValidate(t *testing.T) {
 	if err := Validate(pairs); err != nil {
 		t.Fatalf("validate failed: %v", err)
 	}
-	applied := map[int64]bool{10: true}
+	applied := map[int64]dialect.AppliedMigration{10: {Version: 10}}
 	pending := FilterPending(pairs, applied)
 	if len(pending) != 1 || pending[0].Version != 20 {
 		t.Fatalf("pending mismatch: %+v", pending)
@@ -37,8 +41,147 @@ func TestScanDirAndValidate(t *testing.T) {
 	if len(downs) != 1 || downs[0].Version != 10 {
 		t.Fatalf("downs mismatch: %+v", downs)
 	}
-	status := PrettyPrint(pairs, applied)
+	status := PrettyPrint(pairs, applied, nil, nil)
 	if status == "" {
 		t.Fatalf("status empty")
 	}
+	drifted := PrettyPrint(pairs, applied, []ChecksumMismatch{{Version: 10}}, nil)
+	if !strings.Contains(drifted, "checksum mismatch") {
+		t.Fatalf("drift not shown: %s", drifted)
+	}
+}
+
+func TestHasHeaderDirective(t *testing.T) {
+	sql := "-- add index without locking\n-- scima:no-transaction\nCREATE INDEX CONCURRENTLY i ON t (c);"
+	if !hasHeaderDirective(sql, noTransactionDirective) {
+		t.Fatalf("directive not detected")
+	}
+	late := "CREATE TABLE t (id INT);\n-- scima:no-transaction\n"
+	if hasHeaderDirective(late, noTransactionDirective) {
+		t.Fatalf("directive after first statement must be ignored")
+	}
+}
+
+func TestScanFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"db/0020_add_col.up.sql":  {Data: []byte("-- scima:no-transaction\nALTER TABLE t ADD COLUMN name TEXT;")},
+		"db/0010_init.up.sql":     {Data: []byte("CREATE TABLE t (id INT);")},
+		"db/0010_init.down.sql":   {Data: []byte("DROP TABLE t;")},
+		"db/README.md":            {Data: []byte("not a migration")},
+		"db/nested/0030_x.up.sql": {Data: []byte("SELECT 1;")},
+		"other/0040_skip.up.sql":  {Data: []byte("SELECT 1;")},
+	}
+	pairs, err := ScanFS(fsys, "db", "")
+	if err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+	if len(pairs) != 2 || pairs[0].Up.Version != 10 || pairs[1].Up.Version != 20 {
+		t.Fatalf("unexpected pairs: %+v", pairs)
+	}
+	if pairs[0].Down.FullPath != "db/0010_init.down.sql" || !pairs[1].Up.NoTransaction {
+		t.Fatalf("unexpected files: %+v %+v", pairs[0].Down, pairs[1].Up)
+	}
+	if _, err := ScanFS(fsys, "missing", ""); err == nil {
+		t.Fatalf("expected error for missing directory")
+	}
+}
+
+func TestOutOfOrderStatus(t *testing.T) {
+	pairs, err := ScanFS(fstest.MapFS{
+		"20250101000000_a.up.sql": {Data: []byte("SELECT 1;")},
+		"20250102000000_b.up.sql": {Data: []byte("SELECT 1;")},
+		"20250103000000_c.up.sql": {Data: []byte("SELECT 1;")},
+	}, ".", "")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	applied := map[int64]dialect.AppliedMigration{20250102000000: {Version: 20250102000000}}
+	if older := OutOfOrder(pairs, applied); len(older) != 1 || older[0].Version != 20250101000000 {
+		t.Fatalf("unexpected out of order set: %+v", older)
+	}
+	status := PrettyPrint(pairs, applied, nil, nil)
+	if !strings.Contains(status, "20250101000000\ta\tpending (out of order: older than applied 20250102000000)") ||
+		!strings.Contains(status, "20250103000000\tc\tpending\n") {
+		t.Fatalf("gap not flagged distinctly:\n%s", status)
+	}
+}
+
+func TestScanRepeatable(t *testing.T) {
+	pairs, err := ScanFS(fstest.MapFS{
+		"R__views.sql":       {Data: []byte("CREATE VIEW v AS SELECT 1;")},
+		"R__procs.sql":       {Data: []byte("SELECT 2;")},
+		"0010_init.up.sql":   {Data: []byte("SELECT 1;")},
+		"0020_more.up.sql":   {Data: []byte("SELECT 1;")},
+		"R__bad-name.sql":    {Data: []byte("SELECT 3;")},
+		"0010_init.down.sql": {Data: []byte("SELECT 1;")},
+	}, ".", "")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if len(pairs) != 4 || pairs[1].Up.Version != 20 || pairs[2].Up.Name != "procs" || pairs[3].Up.Name != "views" {
+		t.Fatalf("repeatables not sorted after versioned migrations: %+v", pairs)
+	}
+	views := pairs[3].Up
+	if !views.Repeatable || views.Version != RepeatableVersion("views") || views.Version >= 0 || views.Label() != "R" {
+		t.Fatalf("unexpected repeatable: %+v", views)
+	}
+	if err := Validate(pairs); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	applied := map[int64]dialect.AppliedMigration{10: {Version: 10}, views.Version: {Version: views.Version}, pairs[2].Up.Version: {Version: pairs[2].Up.Version}}
+	if pending := FilterPending(pairs, applied); len(pending) != 1 || pending[0].Version != 20 {
+		t.Fatalf("repeatables must not be pending versions: %+v", pending)
+	}
+	status := PrettyPrint(pairs, applied, nil, []MigrationFile{*views})
+	if !strings.Contains(status, "R\tviews\tchanged\n") || !strings.Contains(status, "R\tprocs\tup to date\n") || !strings.Contains(status, "0020\tmore\tpending\n") {
+		t.Fatalf("unexpected status:\n%s", status)
+	}
+}
+
+func TestScanDialectVariants(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_init.up.sql":                 {Data: []byte("CREATE TABLE users (id INTEGER);")},
+		"0020_add_email.up.sql":            {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")},
+		"0020_add_email.up.hana.sql":       {Data: []byte("ALTER TABLE users ADD (email NVARCHAR(255));")},
+		"0020_add_email.up.postgres.sql":   {Data: []byte("ALTER TABLE users ADD COLUMN email VARCHAR(255);")},
+		"0020_add_email.down.sql":          {Data: []byte("ALTER TABLE users DROP COLUMN email;")},
+		"0030_extension.up.postgres.sql":   {Data: []byte("CREATE EXTENSION citext;")},
+		"0030_extension.down.postgres.sql": {Data: []byte("DROP EXTENSION citext;")},
+	}
+	scan := func(dialectName string) []MigrationPair {
+		t.Helper()
+		pairs, err := ScanFS(fsys, ".", dialectName)
+		if err != nil {
+			t.Fatalf("scan %s: %v", dialectName, err)
+		}
+		return pairs
+	}
+
+	pairs := scan("postgres")
+	if err := Validate(pairs); err != nil {
+		t.Fatalf("validate postgres: %v", err)
+	}
+	if len(pairs) != 3 || pairs[1].Up.Dialect != "postgres" || pairs[1].Down.Dialect != "" || pairs[2].Down.Dialect != "postgres" {
+		t.Fatalf("unexpected postgres pairs: %+v %+v", pairs[1], pairs[2])
+	}
+	if status := PrettyPrint(pairs, nil, nil, nil); !strings.Contains(status, "0020\tadd_email [postgres]\tpending\n") || !strings.Contains(status, "0010\tinit\tpending\n") {
+		t.Fatalf("status does not show the variant:\n%s", status)
+	}
+	if pairs = scan("sqlite"); pairs[1].Up.Dialect != "" {
+		t.Fatalf("sqlite should fall back to the generic file: %+v", pairs[1].Up)
+	}
+	if err := Validate(pairs); err == nil || !strings.Contains(err.Error(), "version 30 has no up file for dialect sqlite, only 0030_extension.down.postgres.sql, 0030_extension.up.postgres.sql") {
+		t.Fatalf("expected missing variant error, got %v", err)
+	}
+	if pairs = scan(""); len(pairs) != 3 || pairs[1].Up.Dialect != "" || pairs[2].Up.Dialect != "postgres" {
+		t.Fatalf("without a dialect generic files win and variants stand in: %+v", pairs)
+	}
+
+	fsys["0020_email.up.postgres.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	if err := Validate(scan("postgres")); err == nil || !strings.Contains(err.Error(), "version 20 has 2 postgres up files, expected one: 0020_add_email.up.postgres.sql, 0020_email.up.postgres.sql") {
+		t.Fatalf("expected duplicate variant error, got %v", err)
+	}
+	if pairs = scan("hana"); pairs[1].Up.Dialect != "hana" || len(pairs[1].problems) != 0 {
+		t.Fatalf("the postgres duplicate must not affect hana: %+v", pairs[1])
+	}
 }
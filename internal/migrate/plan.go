@@ -0,0 +1,223 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+// PlannedStatement is a statement a run would execute, with its bind arguments.
+type PlannedStatement struct {
+	SQL  string
+	Args []any
+}
+
+// String renders the statement followed by a comment listing its arguments, if any.
+func (s PlannedStatement) String() string {
+	if len(s.Args) == 0 {
+		return s.SQL
+	}
+	return fmt.Sprintf("%s -- args: %s", s.SQL, s.formatArgs())
+}
+
+// formatArgs renders the bind arguments as a comma separated list of literals.
+func (s PlannedStatement) formatArgs() string {
+	args := make([]string, len(s.Args))
+	for i, a := range s.Args {
+		args[i] = formatArg(a)
+	}
+	return strings.Join(args, ", ")
+}
+
+// formatArg renders a bind argument as an SQL literal for review.
+func formatArg(a any) string {
+	switch v := a.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case time.Time:
+		return "'" + v.UTC().Format(time.RFC3339) + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// PlannedMigration is a migration together with every statement a run would execute
+// for it: transaction control, the migration's own SQL and the dialect's bookkeeping.
+type PlannedMigration struct {
+	File       MigrationFile
+	Statements []PlannedStatement
+}
+
+// DryRun returns what ApplyPlan(downs, ups) would execute, given the current tracking
+// table rows in applied. Nothing is executed: statements go to a recording connection,
+// so SQL hooks, placeholders, splitting, transactions and dirty tracking follow exactly
+// the path of a real run. Go migrations and Go hooks are not called; a comment marks
+// where Go migrations would run.
+func (m *Migrator) DryRun(ctx context.Context, applied map[int64]dialect.AppliedMigration, downs, ups []MigrationFile) ([]PlannedMigration, error) {
+	rec := &recordingConn{}
+	dry := *m
+	dry.Conn = rec
+	if _, ok := m.Conn.(dialect.TxConn); ok {
+		dry.Conn = recordingTxConn{rec}
+	}
+	dry.Log = nil
+	dry.dryRun = true
+	var plan []PlannedMigration
+	dry.recorder = func(f MigrationFile) {
+		plan = append(plan, PlannedMigration{File: f, Statements: rec.take()})
+	}
+	if err := dry.applyPlan(ctx, applied, downs, ups); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// DryRunStatus returns the applied migrations like Status without creating or
+// upgrading the tracking table. If the table does not exist yet, no migrations are
+// applied and the statements EnsureMigrationTable would execute to create it are
+// returned as a "setup" entry to put ahead of the plan.
+func (m *Migrator) DryRunStatus(ctx context.Context) (map[int64]dialect.AppliedMigration, []PlannedMigration, error) {
+	exists, err := m.Dialect.MigrationTableExists(ctx, m.Conn, m.Schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Statements go to rec, so that nothing the dialect executes reaches the database.
+	rec := &readThroughConn{Conn: m.Conn}
+	applied := map[int64]dialect.AppliedMigration{}
+	if !exists {
+		if err := m.Dialect.EnsureMigrationTable(ctx, rec, m.Schema); err != nil {
+			return nil, nil, err
+		}
+		setup := PlannedMigration{File: MigrationFile{Name: "tracking table", Direction: "setup"}, Statements: rec.recorded.take()}
+		return applied, []PlannedMigration{setup}, nil
+	}
+	rows, err := m.Dialect.SelectApplied(ctx, rec, m.Schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil, nil
+}
+
+// heading names the migration, e.g. "up 0010 init", the SQL hook, e.g. "hook
+// beforeMigrate", or the tracking table setup.
+func (pm PlannedMigration) heading() string {
+	if pm.File.Direction == "hook" || pm.File.Direction == "setup" {
+		return pm.File.Direction + " " + pm.File.Name
+	}
+	return fmt.Sprintf("%s %s %s", pm.File.Direction, pm.File.Label(), pm.File.Name)
+}
+
+// source returns the heading followed by the file path, if there is a file.
+func (pm PlannedMigration) source() string {
+	if pm.File.FullPath == "" {
+		return pm.heading()
+	}
+	return fmt.Sprintf("%s (%s)", pm.heading(), pm.File.FullPath)
+}
+
+// FormatPlan renders a dry run for humans: one block per migration with its statements indented.
+func FormatPlan(plan []PlannedMigration) string {
+	if len(plan) == 0 {
+		return "nothing to do\n"
+	}
+	var sb strings.Builder
+	for _, pm := range plan {
+		fmt.Fprintf(&sb, "%s\n", pm.source())
+		for _, st := range pm.Statements {
+			fmt.Fprintf(&sb, "    %s\n", strings.ReplaceAll(st.String(), "\n", "\n    "))
+		}
+	}
+	return sb.String()
+}
+
+// FormatScript renders a dry run as one SQL script with a marker comment before and
+// after each migration. Bind arguments go in a comment line above their statement so
+// the terminating semicolon stays outside the comment.
+func FormatScript(plan []PlannedMigration) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "-- scima plan: %d migration(s), generated %s\n", len(plan), time.Now().UTC().Format(time.RFC3339))
+	for _, pm := range plan {
+		fmt.Fprintf(&sb, "\n-- >>> %s\n", pm.source())
+		for _, st := range pm.Statements {
+			if len(st.Args) > 0 {
+				fmt.Fprintf(&sb, "-- args: %s\n", st.formatArgs())
+			}
+			fmt.Fprintf(&sb, "%s;\n", st.SQL)
+		}
+		fmt.Fprintf(&sb, "-- <<< %s\n", pm.heading())
+	}
+	return sb.String()
+}
+
+// errDryRunQuery is returned if a dry run tries to read from the database.
+var errDryRunQuery = errors.New("dry run cannot query the database")
+
+// recordingConn records executed statements instead of running them.
+type recordingConn struct {
+	stmts []PlannedStatement
+}
+
+func (r *recordingConn) ExecContext(_ context.Context, query string, args ...any) (dialect.Result, error) {
+	r.stmts = append(r.stmts, PlannedStatement{SQL: query, Args: args})
+	return recordedResult{}, nil
+}
+
+func (r *recordingConn) QueryContext(context.Context, string, ...any) (dialect.Rows, error) {
+	return nil, errDryRunQuery
+}
+
+// take returns the statements recorded since the previous call.
+func (r *recordingConn) take() []PlannedStatement {
+	res := r.stmts
+	r.stmts = nil
+	return res
+}
+
+// readThroughConn records executed statements like recordingConn but runs queries,
+// so that reads see the real database.
+type readThroughConn struct {
+	dialect.Conn
+	recorded recordingConn
+}
+
+func (r *readThroughConn) ExecContext(ctx context.Context, query string, args ...any) (dialect.Result, error) {
+	return r.recorded.ExecContext(ctx, query, args...)
+}
+
+type recordedResult struct{}
+
+func (recordedResult) RowsAffected() (int64, error) { return 0, nil }
+
+// recordingTxConn adds BeginTx to recordingConn for connections supporting transactions.
+type recordingTxConn struct{ *recordingConn }
+
+func (r recordingTxConn) BeginTx(context.Context) (dialect.Tx, error) {
+	r.stmts = append(r.stmts, PlannedStatement{SQL: "BEGIN"})
+	return recordingTx(r), nil
+}
+
+type recordingTx struct{ *recordingConn }
+
+func (t recordingTx) Commit() error {
+	t.stmts = append(t.stmts, PlannedStatement{SQL: "COMMIT"})
+	return nil
+}
+
+func (t recordingTx) Rollback() error {
+	t.stmts = append(t.stmts, PlannedStatement{SQL: "ROLLBACK"})
+	return nil
+}
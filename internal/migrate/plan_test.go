@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+func TestDryRunRecordsWithoutExecuting(t *testing.T) {
+	ctx := context.Background()
+	m, pairs, conn := sqliteMigrator(t, map[string]string{
+		"0010_init.up.sql":    "CREATE TABLE {{schema?}}users (id INTEGER);\nCREATE TABLE roles (id INTEGER);",
+		"0010_init.down.sql":  "DROP TABLE roles;\nDROP TABLE users;",
+		"0020_index.up.sql":   "-- scima:no-transaction\nCREATE INDEX users_id ON users (id);",
+		"0020_index.down.sql": "DROP INDEX users_id;",
+	})
+	applied, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	plan, err := m.DryRun(ctx, applied, nil, FilterPending(pairs, applied))
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(plan) != 2 {
+		t.Fatalf("expected 2 planned migrations, got %d", len(plan))
+	}
+	var got []string
+	for _, st := range plan[0].Statements {
+		got = append(got, st.SQL)
+	}
+	want := []string{"BEGIN", "CREATE TABLE users (id INTEGER)", "CREATE TABLE roles (id INTEGER)"}
+	if len(got) != 5 || strings.Join(got[:3], "|") != strings.Join(want, "|") || !strings.HasPrefix(got[3], "INSERT INTO SCIMA_SCHEMA_MIGRATIONS") || got[4] != "COMMIT" {
+		t.Fatalf("unexpected transactional plan: %q", got)
+	}
+	got = nil
+	for _, st := range plan[1].Statements {
+		got = append(got, st.SQL)
+	}
+	if len(got) != 3 || !strings.HasPrefix(got[0], "INSERT") || got[1] != "CREATE INDEX users_id ON users (id)" || !strings.HasPrefix(got[2], "UPDATE") {
+		t.Fatalf("unexpected no-transaction plan: %q", got)
+	}
+	if tableExists(t, conn, "users") {
+		t.Fatalf("dry run executed migration SQL")
+	}
+	if applied, err := m.Status(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("dry run recorded history: %v %v", applied, err)
+	}
+
+	applied = map[int64]dialect.AppliedMigration{10: {Version: 10}, 20: {Version: 20}}
+	plan, err = m.DryRun(ctx, applied, ReverseForDown(pairs, applied, 0), nil)
+	if err != nil {
+		t.Fatalf("dry run down: %v", err)
+	}
+	if len(plan) != 2 || plan[0].File.Version != 20 || plan[1].File.Version != 10 {
+		t.Fatalf("unexpected down plan: %+v", plan)
+	}
+	last := plan[1].Statements[len(plan[1].Statements)-2]
+	if !strings.HasPrefix(last.SQL, "DELETE FROM SCIMA_SCHEMA_MIGRATIONS") || len(last.Args) != 1 || last.Args[0] != int64(10) {
+		t.Fatalf("unexpected bookkeeping statement: %+v", last)
+	}
+}
+
+func TestDryRunRefusesDirtyAndOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	m, pairs, _ := sqliteMigrator(t, map[string]string{
+		"0010_a.up.sql": "SELECT 1;",
+		"0020_b.up.sql": "SELECT 2;",
+	})
+	if _, err := m.DryRun(ctx, map[int64]dialect.AppliedMigration{10: {Version: 10, Dirty: true}}, nil, FilterPending(pairs, nil)[1:]); err == nil {
+		t.Fatalf("expected dirty error")
+	}
+	applied := map[int64]dialect.AppliedMigration{20: {Version: 20}}
+	if _, err := m.DryRun(ctx, applied, nil, FilterPending(pairs, applied)); err == nil {
+		t.Fatalf("expected out-of-order error")
+	}
+}
+
+func TestFormatScript(t *testing.T) {
+	plan := []PlannedMigration{{
+		File: MigrationFile{Version: 10, Name: "init", Direction: "up", FullPath: "m/0010_init.up.sql"},
+		Statements: []PlannedStatement{
+			{SQL: "CREATE TABLE t (id INTEGER)"},
+			{SQL: "INSERT INTO x VALUES (?, ?, ?)", Args: []any{int64(10), "it's", nil}},
+		},
+	}}
+	script := FormatScript(plan)
+	for _, want := range []string{
+		"-- >>> up 0010 init (m/0010_init.up.sql)\n",
+		"CREATE TABLE t (id INTEGER);\n",
+		"-- args: 10, 'it''s', NULL\nINSERT INTO x VALUES (?, ?, ?);\n",
+		"-- <<< up 0010 init\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("script lacks %q:\n%s", want, script)
+		}
+	}
+	if got := FormatPlan(nil); got != "nothing to do\n" {
+		t.Fatalf("unexpected empty plan: %q", got)
+	}
+}
@@ -0,0 +1,86 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/scima/scima/internal/dialect"
+	"github.com/scima/scima/internal/version"
+)
+
+// ScriptRange returns the migrations with versions from..to for a script: the up files
+// in order or, with down, the down files in reverse order. A bound of 0 leaves that
+// side open. It fails if down is set and a version in range has no down file.
+// Repeatable migrations are left out, since the guards only check whether a version is
+// recorded. Go migrations cannot be rendered as SQL, so a range including one fails.
+func ScriptRange(pairs []MigrationPair, from, to int64, down bool) ([]MigrationFile, error) {
+	var res []MigrationFile
+	var missing, executable []string
+	for _, p := range pairs {
+		if p.Up == nil || p.Up.Repeatable || p.Up.Version < from || to > 0 && p.Up.Version > to {
+			continue
+		}
+		switch {
+		case p.Up.Exec != nil:
+			executable = append(executable, fmt.Sprintf("%04d", p.Up.Version))
+		case !down:
+			res = append(res, *p.Up)
+		case p.Down == nil:
+			missing = append(missing, fmt.Sprintf("%04d", p.Up.Version))
+		default:
+			res = append([]MigrationFile{*p.Down}, res...)
+		}
+	}
+	if len(executable) > 0 {
+		return nil, fmt.Errorf("version(s) %s are Go migrations and cannot be scripted; narrow the range with --from and --to", strings.Join(executable, ", "))
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no down migration for version(s) %s", strings.Join(missing, ", "))
+	}
+	return res, nil
+}
+
+// GenerateScript renders files as one SQL script to run without scima, e.g. by a DBA
+// where tools may not connect to the database. It creates or upgrades the tracking
+// table, then wraps each migration and its bookkeeping in a guard that skips it if
+// the tracking table shows it already ran (or, for downs, did not run).
+func GenerateScript(d dialect.Dialect, schema string, files []MigrationFile) (string, error) {
+	sd, ok := d.(dialect.ScriptDialect)
+	if !ok {
+		return "", fmt.Errorf("dialect %s cannot render guarded scripts", d.Name())
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "-- scima script for %s: %d migration(s), generated %s\n", d.Name(), len(files), time.Now().UTC().Format(time.RFC3339))
+	sb.WriteString("-- Migrations already recorded in the tracking table are skipped, so the script can be rerun.\n\n")
+	sb.WriteString(sd.ScriptPrologue(schema))
+	for _, f := range files {
+		expanded, err := fileSQL(f, d, schema)
+		if err != nil {
+			return "", err
+		}
+		split, err := SplitStatements(expanded, d.Name())
+		if err != nil {
+			return "", fmt.Errorf("split %s %d: %w", f.Direction, f.Version, err)
+		}
+		stmts := make([]string, len(split))
+		for i, st := range split {
+			stmts[i] = st.SQL
+		}
+		fmt.Fprintf(&sb, "\n-- >>> %s %04d %s (%s)\n", f.Direction, f.Version, f.Name, f.FullPath)
+		if f.Direction == "up" {
+			sb.WriteString(sd.ScriptUp(schema, dialect.AppliedMigration{
+				Version:      f.Version,
+				Name:         f.Name,
+				Checksum:     Checksum(expanded),
+				AppliedBy:    osUser(),
+				Hostname:     hostname(),
+				ScimaVersion: version.String(),
+			}, stmts))
+		} else {
+			sb.WriteString(sd.ScriptDown(schema, f.Version, stmts))
+		}
+		fmt.Fprintf(&sb, "-- <<< %s %04d %s\n", f.Direction, f.Version, f.Name)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,61 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+func TestScriptRange(t *testing.T) {
+	pairs := []MigrationPair{
+		{Up: &MigrationFile{Version: 10, Direction: "up"}, Down: &MigrationFile{Version: 10, Direction: "down"}},
+		{Up: &MigrationFile{Version: 20, Direction: "up"}, Down: &MigrationFile{Version: 20, Direction: "down"}},
+		{Up: &MigrationFile{Version: 30, Direction: "up"}},
+	}
+	ups, err := ScriptRange(pairs, 20, 0, false)
+	if err != nil || len(ups) != 2 || ups[0].Version != 20 || ups[1].Version != 30 {
+		t.Fatalf("unexpected ups: %+v %v", ups, err)
+	}
+	downs, err := ScriptRange(pairs, 0, 20, true)
+	if err != nil || len(downs) != 2 || downs[0].Version != 20 || downs[1].Direction != "down" {
+		t.Fatalf("unexpected downs: %+v %v", downs, err)
+	}
+	if _, err := ScriptRange(pairs, 0, 0, true); err == nil || !strings.Contains(err.Error(), "0030") {
+		t.Fatalf("expected missing down error, got %v", err)
+	}
+}
+
+func TestGenerateScript(t *testing.T) {
+	d, err := dialect.Get("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []MigrationFile{{Version: 10, Name: "init", Direction: "up", FullPath: "m/0010_init.up.sql",
+		SQL: "CREATE TABLE {{schema}}.a (id INT);\nCREATE TABLE {{schema}}.b (id INT);"}}
+	script, err := GenerateScript(d, "app", files)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	for _, want := range []string{
+		`CREATE TABLE IF NOT EXISTS "app".SCIMA_SCHEMA_MIGRATIONS`,
+		"-- >>> up 0010 init (m/0010_init.up.sql)\n",
+		`IF NOT EXISTS (SELECT 1 FROM "app".SCIMA_SCHEMA_MIGRATIONS WHERE version = 10)`,
+		"EXECUTE $scima$CREATE TABLE app.a (id INT)$scima$;",
+		"EXECUTE $scima$CREATE TABLE app.b (id INT)$scima$;",
+		"'" + Checksum("CREATE TABLE app.a (id INT);\nCREATE TABLE app.b (id INT);") + "'",
+		"-- <<< up 0010 init\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("script lacks %q:\n%s", want, script)
+		}
+	}
+
+	sqlite, err := dialect.Get("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateScript(sqlite, "", files); err == nil {
+		t.Fatalf("expected sqlite to refuse scripts")
+	}
+}
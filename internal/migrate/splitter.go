@@ -0,0 +1,277 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+const statementBreakDirective = "scima:statement-break"
+
+// Statement is a single SQL statement of a migration file.
+type Statement struct {
+	SQL    string
+	Offset int // byte offset of the first token in the source
+	Line   int // 1-based line of the first token
+	Column int // 1-based column (in bytes) of the first token
+}
+
+// splitFlavor captures the lexical rules of a dialect that matter for splitting.
+type splitFlavor struct {
+	dollarQuotes     bool // Postgres $tag$ ... $tag$ bodies and E'...' strings
+	atomicBlocks     bool // Postgres BEGIN ATOMIC ... END function bodies
+	blocks           bool // procedural BEGIN ... END bodies (HANA SQLScript, MySQL routines, SQLite triggers)
+	backticks        bool // MySQL and SQLite `quoted` identifiers
+	hashComments     bool // MySQL # comments
+	backslashEscapes bool // MySQL \' escapes inside string literals
+}
+
+func flavorFor(dialectName string) splitFlavor {
+	switch dialectName {
+	case "postgres":
+		return splitFlavor{dollarQuotes: true, atomicBlocks: true}
+	case "hana":
+		return splitFlavor{blocks: true}
+	case "mysql":
+		return splitFlavor{blocks: true, backticks: true, hashComments: true, backslashEscapes: true}
+	case "sqlite":
+		return splitFlavor{blocks: true, backticks: true}
+	default:
+		return splitFlavor{}
+	}
+}
+
+// transactionWords follow BEGIN when it starts a transaction rather than a block.
+var transactionWords = map[string]bool{"TRANSACTION": true, "WORK": true, "DEFERRED": true, "IMMEDIATE": true, "EXCLUSIVE": true, "ISOLATION": true, "READ": true}
+
+// endQualifiers follow END when it closes a control statement that did not open a block.
+var endQualifiers = map[string]bool{"IF": true, "FOR": true, "WHILE": true, "LOOP": true, "REPEAT": true}
+
+// SplitStatements splits migration SQL into statements using the lexical rules of
+// the named dialect. Semicolons inside string literals, quoted identifiers, comments,
+// dollar-quoted bodies and BEGIN ... END blocks do not end a statement. A line
+// comment "-- scima:statement-break" always ends the current statement.
+// Trailing semicolons are removed and comment-only statements are dropped.
+func SplitStatements(sql, dialectName string) ([]Statement, error) {
+	s := &splitter{src: sql, flavor: flavorFor(dialectName), first: -1}
+	if err := s.run(); err != nil {
+		return nil, err
+	}
+	return s.stmts, nil
+}
+
+type splitter struct {
+	src     string
+	flavor  splitFlavor
+	stmts   []Statement
+	first   int  // offset of the current statement's first token, -1 while only whitespace/comments were seen
+	depth   int  // nesting of BEGIN/CASE ... END blocks
+	endCase bool // the next word is the CASE of END CASE, which must not open a block
+}
+
+func (s *splitter) run() error {
+	src := s.src
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '#' && s.flavor.hashComments:
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			i += end
+		case c == '-' && strings.HasPrefix(src[i:], "--"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			if strings.TrimSpace(src[i+2:i+end]) == statementBreakDirective {
+				s.emit(i)
+				s.depth = 0
+			}
+			i += end
+		case c == '/' && strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return s.errorf(i, "unterminated block comment")
+			}
+			i += 2 + end + 2
+		case c == '\'':
+			s.mark(i)
+			eString := s.flavor.dollarQuotes && i > 0 && (src[i-1] == 'E' || src[i-1] == 'e') && (i < 2 || !isIdentChar(src[i-2]))
+			end, err := s.quoted(i, '\'', eString || s.flavor.backslashEscapes)
+			if err != nil {
+				return err
+			}
+			i = end
+		case c == '"' || (c == '`' && s.flavor.backticks):
+			s.mark(i)
+			end, err := s.quoted(i, c, c == '"' && s.flavor.backslashEscapes)
+			if err != nil {
+				return err
+			}
+			i = end
+		case c == '$' && s.flavor.dollarQuotes && (i == 0 || !isIdentChar(src[i-1])):
+			s.mark(i)
+			tag, ok := dollarTag(src[i:])
+			if !ok {
+				i++
+				continue
+			}
+			end := strings.Index(src[i+len(tag):], tag)
+			if end < 0 {
+				return s.errorf(i, "unterminated dollar-quoted string %s", tag)
+			}
+			i += len(tag) + end + len(tag)
+		case c == ';':
+			if s.depth == 0 {
+				s.emit(i)
+			}
+			i++
+		case isIdentStart(c) && (i == 0 || !isIdentChar(src[i-1])):
+			s.mark(i)
+			j := i
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			s.word(strings.ToUpper(src[i:j]), j)
+			i = j
+		default:
+			if !isSpace(c) {
+				s.mark(i)
+			}
+			i++
+		}
+	}
+	s.emit(len(src))
+	return nil
+}
+
+// word tracks block nesting from keyword w, which ends at offset j.
+func (s *splitter) word(w string, j int) {
+	switch {
+	case w == "BEGIN" && s.flavor.blocks:
+		if next := s.nextWord(j); next != "" && !transactionWords[next] {
+			s.depth++
+		}
+	case w == "BEGIN" && s.flavor.atomicBlocks:
+		if s.nextWord(j) == "ATOMIC" {
+			s.depth++
+		}
+	case w == "CASE" && s.endCase:
+		s.endCase = false
+	case w == "CASE" && s.depth > 0:
+		s.depth++
+	case w == "END" && s.depth > 0:
+		next := s.nextWord(j)
+		if !endQualifiers[next] {
+			s.depth--
+			s.endCase = next == "CASE"
+		}
+	}
+}
+
+// nextWord returns the upper-cased keyword following offset j, skipping whitespace
+// and comments, or "" if the next token is not a word.
+func (s *splitter) nextWord(j int) string {
+	src := s.src
+	for j < len(src) {
+		switch {
+		case isSpace(src[j]):
+			j++
+		case strings.HasPrefix(src[j:], "--"):
+			end := strings.IndexByte(src[j:], '\n')
+			if end < 0 {
+				return ""
+			}
+			j += end
+		case strings.HasPrefix(src[j:], "/*"):
+			end := strings.Index(src[j+2:], "*/")
+			if end < 0 {
+				return ""
+			}
+			j += 2 + end + 2
+		case isIdentStart(src[j]):
+			k := j
+			for k < len(src) && isIdentChar(src[k]) {
+				k++
+			}
+			return strings.ToUpper(src[j:k])
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+func (s *splitter) mark(i int) {
+	if s.first < 0 {
+		s.first = i
+	}
+}
+
+func (s *splitter) emit(end int) {
+	if s.first >= 0 {
+		text := strings.TrimSpace(s.src[s.first:end])
+		if text != "" {
+			line, col := lineCol(s.src, s.first)
+			s.stmts = append(s.stmts, Statement{SQL: text, Offset: s.first, Line: line, Column: col})
+		}
+	}
+	s.first = -1
+}
+
+// quoted returns the offset after the literal starting at src[i], where doubled quotes escape.
+func (s *splitter) quoted(i int, q byte, backslash bool) (int, error) {
+	src := s.src
+	for j := i + 1; j < len(src); j++ {
+		switch {
+		case backslash && src[j] == '\\':
+			j++
+		case src[j] == q:
+			if j+1 < len(src) && src[j+1] == q {
+				j++
+				continue
+			}
+			return j + 1, nil
+		}
+	}
+	return 0, s.errorf(i, "unterminated quoted string")
+}
+
+func (s *splitter) errorf(offset int, format string, args ...any) error {
+	line, col := lineCol(s.src, offset)
+	return fmt.Errorf("line %d column %d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+// dollarTag returns the opening $tag$ at the start of s.
+func dollarTag(s string) (string, bool) {
+	for j := 1; j < len(s); j++ {
+		switch {
+		case s[j] == '$':
+			return s[:j+1], true
+		case isIdentStart(s[j]) || (j > 1 && s[j] >= '0' && s[j] <= '9'):
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// lineCol converts a byte offset into 1-based line and column numbers.
+func lineCol(src string, offset int) (int, int) {
+	line := 1 + strings.Count(src[:offset], "\n")
+	col := offset - strings.LastIndexByte(src[:offset], '\n')
+	return line, col
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '$' || c == '#'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,136 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func statementTexts(t *testing.T, sql, dialectName string) []string {
+	t.Helper()
+	stmts, err := SplitStatements(sql, dialectName)
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	res := make([]string, 0, len(stmts))
+	for _, s := range stmts {
+		res = append(res, s.SQL)
+	}
+	return res
+}
+
+func TestSplitStatementsBasic(t *testing.T) {
+	sql := "-- create\nCREATE TABLE t (id INT);\n\nINSERT INTO t VALUES (1);\n-- trailing comment only\n"
+	got := statementTexts(t, sql, "hana")
+	want := []string{"CREATE TABLE t (id INT)", "INSERT INTO t VALUES (1)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestSplitStatementsQuotesAndComments(t *testing.T) {
+	sql := `INSERT INTO t VALUES ('a;b', 'it''s');
+SELECT "odd;name" FROM t; /* not ; a break */
+SELECT 1 -- still ; a comment
+;`
+	got := statementTexts(t, sql, "postgres")
+	want := []string{
+		"INSERT INTO t VALUES ('a;b', 'it''s')",
+		`SELECT "odd;name" FROM t`,
+		"SELECT 1 -- still ; a comment",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestSplitStatementsPostgresDollarQuotes(t *testing.T) {
+	sql := `CREATE FUNCTION f() RETURNS trigger AS $body$
+BEGIN
+  NEW.updated := now();
+  RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;
+SELECT E'\';', $1;
+CREATE FUNCTION g() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; SELECT 2; END;
+BEGIN;`
+	got := statementTexts(t, sql, "postgres")
+	if len(got) != 4 {
+		t.Fatalf("expected 4 statements, got %d: %q", len(got), got)
+	}
+	if got[3] != "BEGIN" {
+		t.Fatalf("transaction BEGIN treated as block: %q", got)
+	}
+}
+
+func TestSplitStatementsHanaProcedure(t *testing.T) {
+	sql := `CREATE PROCEDURE p() LANGUAGE SQLSCRIPT AS
+BEGIN
+  DECLARE x INT := 0;
+  IF :x = 0 THEN
+    x := CASE WHEN :x > 1 THEN 1 ELSE 2 END;
+  END IF;
+  FOR i IN 1..3 DO
+    INSERT INTO t VALUES (:i);
+  END FOR;
+END;
+CALL p();`
+	got := statementTexts(t, sql, "hana")
+	if len(got) != 2 || got[1] != "CALL p()" {
+		t.Fatalf("procedure body split: %q", got)
+	}
+}
+
+func TestSplitStatementsBreakDirective(t *testing.T) {
+	sql := "DO BEGIN\n  SELECT 1 FROM DUMMY;\n-- scima:statement-break\nSELECT 2 FROM DUMMY"
+	got := statementTexts(t, sql, "hana")
+	want := []string{"DO BEGIN\n  SELECT 1 FROM DUMMY;", "SELECT 2 FROM DUMMY"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestSplitStatementsPositions(t *testing.T) {
+	stmts, err := SplitStatements("SELECT 1;\n\n  SELECT 2;", "postgres")
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if stmts[1].Line != 3 || stmts[1].Column != 3 {
+		t.Fatalf("unexpected position: %+v", stmts[1])
+	}
+}
+
+func TestSplitStatementsUnterminated(t *testing.T) {
+	if _, err := SplitStatements("SELECT 'oops;", "postgres"); err == nil {
+		t.Fatalf("expected error for unterminated string")
+	}
+	if _, err := SplitStatements("SELECT $x$ body", "postgres"); err == nil {
+		t.Fatalf("expected error for unterminated dollar quote")
+	}
+}
+
+func TestSplitStatementsMySQL(t *testing.T) {
+	sql := "INSERT INTO `odd;t` VALUES ('it\\'s;', \"a;b\"); # note; here\n" +
+		"CREATE TRIGGER trg BEFORE INSERT ON t FOR EACH ROW BEGIN\n  SET NEW.a = 1;\nEND;\nBEGIN;"
+	got := statementTexts(t, sql, "mysql")
+	if len(got) != 3 || got[2] != "BEGIN" {
+		t.Fatalf("unexpected statements: %q", got)
+	}
+}
+
+func TestSplitStatementsEndCase(t *testing.T) {
+	sql := `CREATE PROCEDURE p(IN x INT)
+BEGIN
+  CASE x
+    WHEN 1 THEN SELECT 1;
+    ELSE SELECT 2;
+  END CASE;
+END;
+CREATE TABLE a (id INT);
+CREATE TABLE b (id INT);`
+	for _, dialectName := range []string{"mysql", "hana"} {
+		got := statementTexts(t, sql, dialectName)
+		if len(got) != 3 || got[1] != "CREATE TABLE a (id INT)" || got[2] != "CREATE TABLE b (id INT)" {
+			t.Fatalf("%s: END CASE left the block open: %q", dialectName, got)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+// sqliteMigrator runs migrations from files against a fresh SQLite database, so the
+// migrator can be tested end-to-end without Docker.
+func sqliteMigrator(t *testing.T, files map[string]string) (*Migrator, []MigrationPair, *sql.Conn) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pairs, err := ScanDir(dir, "sqlite")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	d, err := dialect.Get("sqlite")
+	if err != nil {
+		t.Fatalf("dialect: %v", err)
+	}
+	return NewMigrator(d, dialect.SQLConn{DB: conn}, ""), pairs, conn
+}
+
+func tableExists(t *testing.T, conn *sql.Conn, name string) bool {
+	t.Helper()
+	var n int
+	if err := conn.QueryRowContext(context.Background(), "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n); err != nil {
+		t.Fatalf("query sqlite_master: %v", err)
+	}
+	return n == 1
+}
+
+func TestSQLiteApplyUpDown(t *testing.T) {
+	ctx := context.Background()
+	m, pairs, conn := sqliteMigrator(t, map[string]string{
+		"0010_init.up.sql":   "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);\nCREATE TRIGGER users_name AFTER INSERT ON users BEGIN\n  UPDATE users SET name = upper(NEW.name) WHERE id = NEW.id;\nEND;",
+		"0010_init.down.sql": "DROP TABLE users;",
+		"0020_seed.up.sql":   "INSERT INTO users (name) VALUES ('ada');",
+		"0020_seed.down.sql": "DELETE FROM users;",
+	})
+	err := m.WithLock(ctx, func(ctx context.Context) error {
+		applied, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return m.ApplyUp(ctx, FilterPending(pairs, applied))
+	})
+	if err != nil {
+		t.Fatalf("apply up: %v", err)
+	}
+	var name string
+	if err := conn.QueryRowContext(ctx, "SELECT name FROM users").Scan(&name); err != nil || name != "ADA" {
+		t.Fatalf("trigger did not run: %q %v", name, err)
+	}
+	applied, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if len(applied) != 2 || applied[20].Checksum == "" || applied[20].AppliedAt.IsZero() {
+		t.Fatalf("unexpected history: %+v", applied)
+	}
+	if err := m.ApplyDown(ctx, ReverseForDown(pairs, applied, 2)); err != nil {
+		t.Fatalf("apply down: %v", err)
+	}
+	if tableExists(t, conn, "users") {
+		t.Fatalf("users table still exists after down")
+	}
+}
+
+func TestSQLiteFailedMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	m, pairs, conn := sqliteMigrator(t, map[string]string{
+		"0010_broken.up.sql": "CREATE TABLE t (id INTEGER);\nINSERT INTO missing VALUES (1);",
+	})
+	err := m.ApplyUp(ctx, FilterPending(pairs, nil))
+	var me *MigrationError
+	if !errors.As(err, &me) || me.StatementIndex != 2 || me.Line != 2 {
+		t.Fatalf("expected error at statement 2, got %v", err)
+	}
+	if tableExists(t, conn, "t") {
+		t.Fatalf("DDL not rolled back")
+	}
+	applied, err := m.Status(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("expected no history rows, got %v %v", applied, err)
+	}
+}
+
+func TestSQLiteForeignKeysPragma(t *testing.T) {
+	ctx := context.Background()
+	rebuild := "PRAGMA foreign_keys = OFF;\nCREATE TABLE t2 (id INTEGER PRIMARY KEY);\nPRAGMA foreign_keys = ON;"
+	m, pairs, _ := sqliteMigrator(t, map[string]string{"0010_rebuild.up.sql": rebuild})
+	err := m.ApplyUp(ctx, FilterPending(pairs, nil))
+	if err == nil || !strings.Contains(err.Error(), "PRAGMA foreign_keys has no effect inside a transaction") || !strings.Contains(err.Error(), ":1:1") {
+		t.Fatalf("expected foreign_keys error at line 1, got %v", err)
+	}
+
+	m, pairs, conn := sqliteMigrator(t, map[string]string{"0010_rebuild.up.sql": "-- scima:no-transaction\n" + rebuild})
+	if err := m.ApplyUp(ctx, FilterPending(pairs, nil)); err != nil {
+		t.Fatalf("apply without transaction: %v", err)
+	}
+	var on int
+	if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&on); err != nil || on != 1 {
+		t.Fatalf("foreign_keys not enabled: %d %v", on, err)
+	}
+}
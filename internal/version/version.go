@@ -0,0 +1,19 @@
+// Package version reports the scima build version recorded in the migration history.
+package version
+
+import "runtime/debug"
+
+// Version is the release version, set at build time with
+// -ldflags "-X github.com/scima/scima/internal/version.Version=v1.2.3".
+var Version = "dev"
+
+// String returns Version, falling back to the module version embedded by `go install`.
+func String() string {
+	if Version != "dev" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return Version
+}
@@ -0,0 +1,12 @@
+package version
+
+import "testing"
+
+func TestStringOverride(t *testing.T) {
+	old := Version
+	defer func() { Version = old }()
+	Version = "v1.2.3"
+	if got := String(); got != "v1.2.3" {
+		t.Fatalf("unexpected version: %s", got)
+	}
+}
@@ -0,0 +1,45 @@
+package scima
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/scima/scima/internal/migrate"
+)
+
+// CreateOptions controls how Create numbers and fills new migration files.
+type CreateOptions struct {
+	// Step is the increment for sequential versions (default 10: 0010, 0020, ...).
+	Step int64
+	// Timestamp numbers the migration with the current UTC time as YYYYMMDDHHMMSS instead.
+	Timestamp bool
+	// Template is a text/template for the header of both files, rendered with
+	// .Version, .Name and .Direction (default migrate.DefaultTemplate).
+	Template string
+}
+
+// Create scaffolds an up and a down file for description in dir and returns their paths.
+// The description is reduced to the characters allowed in migration file names.
+func Create(dir, description string, opts CreateOptions) ([]string, error) {
+	name := migrate.SanitizeName(description)
+	if name == "" {
+		return nil, fmt.Errorf("description %q contains no letters or digits", description)
+	}
+	pairs, err := migrate.ScanDir(dir, "")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if opts.Step == 0 {
+		opts.Step = 10
+	}
+	if opts.Template == "" {
+		opts.Template = migrate.DefaultTemplate
+	}
+	version := migrate.NextVersion(pairs, opts.Step)
+	if opts.Timestamp {
+		version = migrate.TimestampVersion(time.Now())
+	}
+	return migrate.CreateFiles(dir, pairs, version, name, opts.Template)
+}
@@ -0,0 +1,567 @@
+// Package scima is the importable API of the scima schema migration tool.
+//
+// Services can apply their migrations at startup instead of shelling out to the CLI:
+//
+//	m, err := scima.New(db, scima.WithDialect("postgres"), scima.WithDir("./migrations"))
+//	if err != nil {
+//		return err
+//	}
+//	applied, err := m.Up(ctx)
+//
+// The scima command in cmd/scima is built on this package.
+package scima
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"time"
+
+	"github.com/scima/scima/internal/dialect"
+	"github.com/scima/scima/internal/logging"
+	"github.com/scima/scima/internal/migrate"
+)
+
+// Dialect and the types it operates on, for registering third party dialects.
+type (
+	Dialect          = dialect.Dialect
+	Conn             = dialect.Conn
+	TxConn           = dialect.TxConn
+	Tx               = dialect.Tx
+	Result           = dialect.Result
+	Rows             = dialect.Rows
+	ErrorDetails     = dialect.ErrorDetails
+	AppliedMigration = dialect.AppliedMigration
+)
+
+// Migration files and reports.
+type (
+	Migration        = migrate.MigrationFile
+	MigrationPair    = migrate.MigrationPair
+	ChecksumMismatch = migrate.ChecksumMismatch
+	// MigrationError reports the file, line and driver details of a failed statement.
+	MigrationError = migrate.MigrationError
+	// OutOfOrderError lists pending migrations older than the latest applied one.
+	OutOfOrderError = migrate.OutOfOrderError
+	// PlannedMigration is a migration with the statements a run would execute for it.
+	PlannedMigration = migrate.PlannedMigration
+	PlannedStatement = migrate.PlannedStatement
+)
+
+// Migrations written in Go, registered with WithMigration.
+type (
+	// ExecutableMigration runs Go code, e.g. a backfill SQL cannot express, as a migration.
+	ExecutableMigration = migrate.ExecutableMigration
+	// ReversibleMigration is an ExecutableMigration with a Down method.
+	ReversibleMigration = migrate.ReversibleMigration
+	// MigrationFunc adapts a function to an ExecutableMigration without a down step.
+	MigrationFunc = migrate.MigrationFunc
+	// Hooks are called before and after a run and each of its migrations, see WithHooks.
+	Hooks = migrate.Hooks
+	// NoHooks implements Hooks doing nothing; embed it to implement only some callbacks.
+	NoHooks = migrate.NoHooks
+)
+
+// Logger receives one line per migration event, see WithLogger.
+type Logger = logging.Logger
+
+var (
+	// ErrDirty is returned while a migration that failed halfway awaits manual repair.
+	ErrDirty = migrate.ErrDirty
+	// ErrLockTimeout is returned when another run held the migration lock for too long.
+	ErrLockTimeout = dialect.ErrLockTimeout
+)
+
+// RegisterDialect makes d available to WithDialect and Open under d.Name().
+// Registering a name twice replaces the earlier dialect.
+func RegisterDialect(d Dialect) { dialect.Register(d) }
+
+// DefaultLockTimeout is how long Up, Down, MigrateTo and Force wait for a concurrent run.
+const DefaultLockTimeout = time.Minute
+
+type options struct {
+	dialect     string
+	schema      string
+	dir         string
+	fsys        fs.FS // when set, dir is a path within fsys
+	logHandler  slog.Handler
+	lockTimeout time.Duration
+	outOfOrder  bool
+	executables []migrate.Executable
+	hooks       []Hooks
+}
+
+// Option configures a Migrator.
+type Option func(*options)
+
+// WithDialect selects the registered dialect by name ("hana", "postgres", "mysql", "sqlite").
+func WithDialect(name string) Option { return func(o *options) { o.dialect = name } }
+
+// WithSchema qualifies the tracking table and fills {{schema}} placeholders.
+func WithSchema(schema string) Option { return func(o *options) { o.schema = schema } }
+
+// WithDir reads migration files from the directory dir on disk (default "./migrations").
+// It replaces a source set by an earlier WithFS.
+func WithDir(dir string) Option { return func(o *options) { o.fsys, o.dir = nil, dir } }
+
+// WithFS reads migration files from directory dir of fsys ("." for its root), for
+// example migrations embedded with //go:embed. It replaces a source set by an earlier
+// WithDir, so the last source option wins.
+func WithFS(fsys fs.FS, dir string) Option { return func(o *options) { o.fsys, o.dir = fsys, dir } }
+
+// WithLogger reports migration events at info level and above to l, one key=value
+// line per event. By default nothing is logged.
+func WithLogger(l Logger) Option {
+	return func(o *options) { o.logHandler = logging.NewPrintfHandler(l, slog.LevelInfo) }
+}
+
+// WithLogHandler sends structured migration events to h: "lock acquired", "plan
+// computed", "migration started", "migration finished" and "migration failed" at
+// info or error level, and "statement executed" at debug level. Events carry the
+// migration's version, name and direction and, once done, its duration. It replaces
+// a logger set by an earlier WithLogger.
+func WithLogHandler(h slog.Handler) Option { return func(o *options) { o.logHandler = h } }
+
+// WithLockTimeout sets how long to wait for the migration lock (default DefaultLockTimeout).
+func WithLockTimeout(d time.Duration) Option { return func(o *options) { o.lockTimeout = d } }
+
+// WithAllowOutOfOrder lets Up and MigrateTo apply pending migrations older than the latest
+// applied version, flagging them in the history. Without it they fail with *OutOfOrderError.
+func WithAllowOutOfOrder(allow bool) Option { return func(o *options) { o.outOfOrder = allow } }
+
+// WithMigration registers a migration written in Go under version and name. It runs
+// in version order among the migration files, on the migration's transaction when the
+// dialect supports transactional DDL; down and MigrateTo revert it only if mig implements
+// ReversibleMigration. Versions must not collide with migration files.
+func WithMigration(version int64, name string, mig ExecutableMigration) Option {
+	return func(o *options) {
+		o.executables = append(o.executables, migrate.Executable{Version: version, Name: name, Migration: mig})
+	}
+}
+
+// WithHooks calls h around each run of Up, Down and MigrateTo that has migrations to run,
+// and around each of those migrations. Hooks given by several WithHooks are called
+// in order. SQL hook files in the migration source (beforeMigrate.sql,
+// beforeEach.sql, afterEach.sql, afterMigrate.sql, afterMigrateError.sql) run at
+// the same points without it.
+func WithHooks(h Hooks) Option { return func(o *options) { o.hooks = append(o.hooks, h) } }
+
+// Migrator applies the migrations of one source to one database.
+// It is safe for concurrent use; each operation runs on its own connection.
+type Migrator struct {
+	db      *sql.DB
+	ownsDB  bool
+	dialect Dialect
+	opts    options
+}
+
+// New returns a Migrator for db. WithDialect is required.
+func New(db *sql.DB, opts ...Option) (*Migrator, error) {
+	o := options{dir: "./migrations", lockTimeout: DefaultLockTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.dialect == "" {
+		return nil, errors.New("scima: dialect required (use WithDialect)")
+	}
+	d, err := dialect.Get(o.dialect)
+	if err != nil {
+		return nil, fmt.Errorf("scima: %w", err)
+	}
+	return &Migrator{db: db, dialect: d, opts: o}, nil
+}
+
+// Open connects to dsn with the database/sql driver matching dialectName and returns
+// a Migrator owning the connection pool; Close releases it. The driver package must
+// be imported by the caller, e.g. _ "github.com/lib/pq".
+func Open(dialectName, dsn string, opts ...Option) (*Migrator, error) {
+	if dsn == "" {
+		return nil, errors.New("dsn required")
+	}
+	db, err := sql.Open(DriverName(dialectName), dsn)
+	if err != nil {
+		return nil, err
+	}
+	m, err := New(db, append([]Option{WithDialect(dialectName)}, opts...)...)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	m.ownsDB = true
+	return m, nil
+}
+
+// DriverName returns the database/sql driver name used for a dialect.
+func DriverName(dialectName string) string {
+	switch dialectName {
+	case "hana":
+		return "hdb"
+	case "postgres", "pg":
+		return "postgres"
+	default:
+		return dialectName // assume same
+	}
+}
+
+// Close closes the database if the Migrator was created by Open.
+func (m *Migrator) Close() error {
+	if !m.ownsDB {
+		return nil
+	}
+	return m.db.Close()
+}
+
+// Run applies all pending migrations to db; it is shorthand for New followed by Up.
+func Run(ctx context.Context, db *sql.DB, opts ...Option) ([]Migration, error) {
+	m, err := New(db, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return m.Up(ctx)
+}
+
+// session runs fn with a migrator pinned to a single connection, which session
+// scoped locks (pg_advisory_lock, GET_LOCK) rely on.
+func (m *Migrator) session(ctx context.Context, fn func(mg *migrate.Migrator) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := conn.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("close connection: %w", cerr)
+		}
+	}()
+	mg := migrate.NewMigrator(m.dialect, dialect.SQLConn{DB: conn}, m.opts.schema)
+	mg.LockTimeout = m.opts.lockTimeout
+	if m.opts.logHandler != nil {
+		mg.Log = slog.New(m.opts.logHandler)
+	}
+	mg.AllowOutOfOrder = m.opts.outOfOrder
+	mg.Hooks = m.opts.hooks
+	return fn(mg)
+}
+
+// scan reads the migration files from the configured source and adds the Go migrations.
+func (m *Migrator) scan() ([]MigrationPair, error) {
+	var pairs []MigrationPair
+	var err error
+	if m.opts.fsys != nil {
+		pairs, err = migrate.ScanFS(m.opts.fsys, m.opts.dir, m.dialect.Name())
+	} else {
+		pairs, err = migrate.ScanDir(m.opts.dir, m.dialect.Name())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return migrate.MergeExecutables(pairs, m.opts.executables)
+}
+
+// sqlHooks reads the SQL hook files from the configured source.
+func (m *Migrator) sqlHooks() (migrate.SQLHooks, error) {
+	if m.opts.fsys != nil {
+		return migrate.ScanHooksFS(m.opts.fsys, m.opts.dir, m.dialect.Name())
+	}
+	return migrate.ScanHooksDir(m.opts.dir, m.dialect.Name())
+}
+
+// Migrations reads and validates the migration files.
+func (m *Migrator) Migrations() ([]MigrationPair, error) {
+	pairs, err := m.scan()
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate.Validate(pairs); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// Init creates the migration tracking table if it does not exist.
+func (m *Migrator) Init(ctx context.Context) error {
+	return m.session(ctx, func(mg *migrate.Migrator) error {
+		return mg.EnsureMigrationTable(ctx)
+	})
+}
+
+// Up applies all pending migrations and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.UpSteps(ctx, 0)
+}
+
+// UpSteps applies the next steps pending migrations (all when steps is 0).
+func (m *Migrator) UpSteps(ctx context.Context, steps int) ([]Migration, error) {
+	return m.apply(ctx, planUpSteps(steps))
+}
+
+// UpTo applies the pending migrations with versions up to and including target.
+func (m *Migrator) UpTo(ctx context.Context, target int64) ([]Migration, error) {
+	return m.apply(ctx, planUpTo(target))
+}
+
+// Down reverts the last steps applied migrations (all when steps is 0) and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	return m.apply(ctx, planDown(steps))
+}
+
+// MigrateTo migrates up or down until target is the highest applied version (0
+// reverts everything) and returns the migrations it ran. It fails before running
+// anything if target is unknown or a needed down file is missing.
+func (m *Migrator) MigrateTo(ctx context.Context, target int64) ([]Migration, error) {
+	return m.locked(ctx, func(ctx context.Context, mg *migrate.Migrator, pairs []MigrationPair) ([]Migration, error) {
+		return mg.MigrateTo(ctx, pairs, target)
+	})
+}
+
+// To is shorthand for MigrateTo.
+func (m *Migrator) To(ctx context.Context, target int64) ([]Migration, error) {
+	return m.MigrateTo(ctx, target)
+}
+
+// planner picks the migrations to revert and then apply, given the migration files,
+// the tracking table rows and the repeatable migrations that are new or changed.
+type planner func(pairs []MigrationPair, applied map[int64]AppliedMigration, due []Migration) (downs, ups []Migration, err error)
+
+func planUpSteps(steps int) planner {
+	return func(pairs []MigrationPair, applied map[int64]AppliedMigration, due []Migration) ([]Migration, []Migration, error) {
+		pending := migrate.FilterPending(pairs, applied)
+		if steps > 0 && steps < len(pending) {
+			pending = pending[:steps]
+		}
+		return nil, migrate.WithRepeatables(pairs, applied, pending, due), nil
+	}
+}
+
+func planUpTo(target int64) planner {
+	return func(pairs []MigrationPair, applied map[int64]AppliedMigration, due []Migration) ([]Migration, []Migration, error) {
+		var pending []Migration
+		for _, up := range migrate.FilterPending(pairs, applied) {
+			if up.Version <= target {
+				pending = append(pending, up)
+			}
+		}
+		return nil, migrate.WithRepeatables(pairs, applied, pending, due), nil
+	}
+}
+
+func planDown(steps int) planner {
+	return func(pairs []MigrationPair, applied map[int64]AppliedMigration, _ []Migration) ([]Migration, []Migration, error) {
+		return migrate.ReverseForDown(pairs, applied, steps), nil, nil
+	}
+}
+
+func planTo(target int64) planner {
+	return func(pairs []MigrationPair, applied map[int64]AppliedMigration, due []Migration) ([]Migration, []Migration, error) {
+		downs, ups, err := migrate.PlanTo(pairs, applied, target)
+		if err != nil || len(downs) > 0 {
+			return downs, ups, err
+		}
+		return nil, migrate.WithRepeatables(pairs, applied, ups, due), nil
+	}
+}
+
+// apply runs the migrations picked by p under the migration lock and returns them
+// if all of them succeed.
+func (m *Migrator) apply(ctx context.Context, p planner) ([]Migration, error) {
+	return m.locked(ctx, func(ctx context.Context, mg *migrate.Migrator, pairs []MigrationPair) ([]Migration, error) {
+		applied, err := mg.Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		due, err := mg.DueRepeatables(pairs, applied)
+		if err != nil {
+			return nil, err
+		}
+		downs, ups, err := p(pairs, applied, due)
+		if err != nil {
+			return nil, err
+		}
+		if err := mg.ApplyPlan(ctx, downs, ups); err != nil {
+			return nil, err
+		}
+		return append(downs, ups...), nil
+	})
+}
+
+// locked reads the migrations and SQL hooks and calls fn under the migration lock.
+func (m *Migrator) locked(ctx context.Context, fn func(ctx context.Context, mg *migrate.Migrator, pairs []MigrationPair) ([]Migration, error)) ([]Migration, error) {
+	pairs, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := m.sqlHooks()
+	if err != nil {
+		return nil, err
+	}
+	var ran []Migration
+	err = m.session(ctx, func(mg *migrate.Migrator) error {
+		mg.SQLHooks = hooks
+		return mg.WithLock(ctx, func(ctx context.Context) error {
+			var err error
+			ran, err = fn(ctx, mg, pairs)
+			return err
+		})
+	})
+	return ran, err
+}
+
+// Plan lists every statement an Up, Down or To call would execute, migration by
+// migration, including transaction control and tracking table bookkeeping.
+type Plan struct {
+	Migrations []PlannedMigration
+}
+
+// String renders the plan for review on a terminal.
+func (p *Plan) String() string { return migrate.FormatPlan(p.Migrations) }
+
+// Script renders the plan as a single SQL script with a marker comment around each migration.
+func (p *Plan) Script() string { return migrate.FormatScript(p.Migrations) }
+
+// PlanUp returns what UpSteps(ctx, steps) would execute, without executing it.
+func (m *Migrator) PlanUp(ctx context.Context, steps int) (*Plan, error) {
+	return m.plan(ctx, planUpSteps(steps))
+}
+
+// PlanUpTo returns what UpTo(ctx, target) would execute, without executing it.
+func (m *Migrator) PlanUpTo(ctx context.Context, target int64) (*Plan, error) {
+	return m.plan(ctx, planUpTo(target))
+}
+
+// PlanDown returns what Down(ctx, steps) would execute, without executing it.
+func (m *Migrator) PlanDown(ctx context.Context, steps int) (*Plan, error) {
+	return m.plan(ctx, planDown(steps))
+}
+
+// PlanTo returns what MigrateTo(ctx, target) would execute, without executing it.
+func (m *Migrator) PlanTo(ctx context.Context, target int64) (*Plan, error) {
+	return m.plan(ctx, planTo(target))
+}
+
+// plan dry runs the migrations picked by p. It reads the tracking table, without
+// creating or upgrading it, but takes no lock, so a concurrent run may change what a
+// real run would do.
+func (m *Migrator) plan(ctx context.Context, p planner) (*Plan, error) {
+	pairs, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := m.sqlHooks()
+	if err != nil {
+		return nil, err
+	}
+	res := &Plan{}
+	err = m.session(ctx, func(mg *migrate.Migrator) error {
+		mg.SQLHooks = hooks
+		applied, setup, err := mg.DryRunStatus(ctx)
+		if err != nil {
+			return err
+		}
+		due, err := mg.DueRepeatables(pairs, applied)
+		if err != nil {
+			return err
+		}
+		downs, ups, err := p(pairs, applied, due)
+		if err != nil {
+			return err
+		}
+		planned, err := mg.DryRun(ctx, applied, downs, ups)
+		res.Migrations = append(setup, planned...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Status describes the migration files and what the database recorded about them.
+type Status struct {
+	Migrations []MigrationPair
+	Applied    map[int64]AppliedMigration
+	Mismatches []ChecksumMismatch
+	// Repeatables are the repeatable migrations that are new or changed since they last ran.
+	Repeatables []Migration
+}
+
+// Pending returns the versioned up migrations not applied yet.
+func (s *Status) Pending() []Migration { return migrate.FilterPending(s.Migrations, s.Applied) }
+
+// OutOfOrder returns the pending migrations older than the latest applied version.
+func (s *Status) OutOfOrder() []Migration { return migrate.OutOfOrder(s.Migrations, s.Applied) }
+
+// String renders one line per migration with its state.
+func (s *Status) String() string {
+	return migrate.PrettyPrint(s.Migrations, s.Applied, s.Mismatches, s.Repeatables)
+}
+
+// Status reports which migrations are applied, pending, dirty or changed since applied.
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	pairs, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	st := &Status{Migrations: pairs}
+	err = m.session(ctx, func(mg *migrate.Migrator) error {
+		if st.Applied, err = mg.Status(ctx); err != nil {
+			return err
+		}
+		if st.Repeatables, err = mg.DueRepeatables(pairs, st.Applied); err != nil {
+			return err
+		}
+		st.Mismatches, err = mg.Verify(ctx, pairs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Verify returns the applied migrations whose files changed since they were applied.
+func (m *Migrator) Verify(ctx context.Context) ([]ChecksumMismatch, error) {
+	pairs, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var res []ChecksumMismatch
+	err = m.session(ctx, func(mg *migrate.Migrator) error {
+		res, err = mg.Verify(ctx, pairs)
+		return err
+	})
+	return res, err
+}
+
+// History returns the tracking table rows in the order they were applied.
+func (m *Migrator) History(ctx context.Context) ([]AppliedMigration, error) {
+	var res []AppliedMigration
+	err := m.session(ctx, func(mg *migrate.Migrator) error {
+		var err error
+		res, err = mg.History(ctx)
+		return err
+	})
+	return res, err
+}
+
+// Force records version as applied (applied=true) or pending after a failed
+// migration was repaired by hand.
+func (m *Migrator) Force(ctx context.Context, version int64, applied bool) error {
+	pairs, err := m.scan()
+	if err != nil {
+		return err
+	}
+	return m.session(ctx, func(mg *migrate.Migrator) error {
+		return mg.WithLock(ctx, func(ctx context.Context) error {
+			return mg.Force(ctx, pairs, version, applied)
+		})
+	})
+}
+
+// Unlock clears a migration lock left behind by a crashed run.
+func (m *Migrator) Unlock(ctx context.Context) error {
+	return m.session(ctx, func(mg *migrate.Migrator) error {
+		return mg.ForceUnlock(ctx)
+	})
+}
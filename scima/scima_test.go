@@ -0,0 +1,449 @@
+package scima
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/scima/scima/internal/dialect"
+)
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var testMigrations = map[string]string{
+	"0010_init.up.sql":     "CREATE TABLE users (id INTEGER PRIMARY KEY);",
+	"0010_init.down.sql":   "DROP TABLE users;",
+	"0020_email.up.sql":    "ALTER TABLE users ADD COLUMN email TEXT;",
+	"0020_email.down.sql":  "ALTER TABLE users DROP COLUMN email;",
+	"0030_orders.up.sql":   "CREATE TABLE orders (id INTEGER PRIMARY KEY);",
+	"0030_orders.down.sql": "DROP TABLE orders;",
+}
+
+func versions(ms []Migration) []int64 {
+	res := make([]int64, 0, len(ms))
+	for _, m := range ms {
+		res = append(res, m.Version)
+	}
+	return res
+}
+
+func TestMigratorUpStepsToDown(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(openDB(t), WithDialect("sqlite"), WithDir(writeMigrations(t, testMigrations)))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ran, err := m.UpSteps(ctx, 1)
+	if err != nil || len(ran) != 1 || ran[0].Version != 10 {
+		t.Fatalf("up 1 step: %v %v", versions(ran), err)
+	}
+	if ran, err = m.UpTo(ctx, 20); err != nil || len(ran) != 1 || ran[0].Version != 20 {
+		t.Fatalf("up to 20: %v %v", versions(ran), err)
+	}
+	st, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if pending := st.Pending(); len(pending) != 1 || pending[0].Version != 30 || !strings.Contains(st.String(), "0030\torders\tpending") {
+		t.Fatalf("unexpected status:\n%s", st)
+	}
+	if ran, err = m.Up(ctx); err != nil || len(ran) != 1 {
+		t.Fatalf("up: %v %v", versions(ran), err)
+	}
+	if ran, err = m.To(ctx, 10); err != nil || len(ran) != 2 || ran[0].Version != 30 || ran[0].Direction != "down" {
+		t.Fatalf("to 10: %v %v", versions(ran), err)
+	}
+	if ran, err = m.Down(ctx, 0); err != nil || len(ran) != 1 {
+		t.Fatalf("down: %v %v", versions(ran), err)
+	}
+	history, err := m.History(ctx)
+	if err != nil || len(history) != 0 {
+		t.Fatalf("expected empty history, got %v %v", history, err)
+	}
+}
+
+func TestMigratorToRequiresDownFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := writeMigrations(t, map[string]string{
+		"0010_init.up.sql":   "CREATE TABLE t (id INTEGER);",
+		"0020_more.up.sql":   "CREATE TABLE u (id INTEGER);",
+		"0010_init.down.sql": "DROP TABLE t;",
+	})
+	m, err := New(openDB(t), WithDialect("sqlite"), WithDir(dir))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := Run(ctx, m.db, WithDialect("sqlite"), WithDir(dir)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if _, err := m.To(ctx, 0); err == nil || !strings.Contains(err.Error(), "no down migration for version(s) 0020") {
+		t.Fatalf("expected missing down error, got %v", err)
+	}
+	st, err := m.Status(ctx)
+	if err != nil || len(st.Applied) != 2 {
+		t.Fatalf("nothing should have been reverted: %v %v", st, err)
+	}
+}
+
+func TestMigratorUpRefusesDirtyLastVersion(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(openDB(t), WithDialect("sqlite"), WithDir(writeMigrations(t, map[string]string{
+		"0010_init.up.sql": "CREATE TABLE t (id INTEGER);",
+		"0020_half.up.sql": "-- scima:no-transaction\nCREATE TABLE u (id INTEGER);\nINSERT INTO nope VALUES (1);",
+	})))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := m.Up(ctx); err == nil {
+		t.Fatalf("expected 0020 to fail halfway")
+	}
+	if _, err := m.Up(ctx); !errors.Is(err, ErrDirty) {
+		t.Fatalf("up on a dirty database: expected ErrDirty, got %v", err)
+	}
+	if _, err := m.PlanUp(ctx, 0); !errors.Is(err, ErrDirty) {
+		t.Fatalf("dry run on a dirty database: expected ErrDirty, got %v", err)
+	}
+}
+
+func TestMigratorPlan(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(openDB(t), WithDialect("sqlite"), WithDir(writeMigrations(t, testMigrations)))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	plan, err := m.PlanUp(ctx, 2)
+	if err != nil || len(plan.Migrations) != 3 || !strings.HasPrefix(plan.String(), "setup tracking table\n    CREATE TABLE IF NOT EXISTS SCIMA_SCHEMA_MIGRATIONS") {
+		t.Fatalf("plan up: %+v %v", plan, err)
+	}
+	var tables int
+	if err := m.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&tables); err != nil || tables != 0 {
+		t.Fatalf("dry run changed the empty database: %d tables, %v", tables, err)
+	}
+	if script := plan.Script(); !strings.Contains(script, "-- >>> up 0020 email") || !strings.Contains(script, "ALTER TABLE users ADD COLUMN email TEXT;") {
+		t.Fatalf("unexpected script:\n%s", script)
+	}
+	st, err := m.Status(ctx)
+	if err != nil || len(st.Applied) != 0 {
+		t.Fatalf("plan applied migrations: %v %v", st, err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if plan, err = m.PlanTo(ctx, 10); err != nil || len(plan.Migrations) != 2 || plan.Migrations[0].File.Version != 30 {
+		t.Fatalf("plan to 10: %+v %v", plan, err)
+	}
+	if plan, err = m.PlanDown(ctx, 1); err != nil || !strings.HasPrefix(plan.String(), "down 0030 orders") {
+		t.Fatalf("plan down: %v %v", plan, err)
+	}
+	if plan, err = m.PlanUpTo(ctx, 30); err != nil || plan.String() != "nothing to do\n" {
+		t.Fatalf("plan up to 30: %v %v", plan, err)
+	}
+	if st, err = m.Status(ctx); err != nil || len(st.Applied) != 3 {
+		t.Fatalf("plan reverted migrations: %v %v", st, err)
+	}
+}
+
+func TestMigratorRepeatables(t *testing.T) {
+	ctx := context.Background()
+	dir := writeMigrations(t, map[string]string{
+		"0010_init.up.sql":    "CREATE TABLE users (id INTEGER PRIMARY KEY, active INTEGER);",
+		"0020_more.up.sql":    "CREATE TABLE roles (id INTEGER PRIMARY KEY);",
+		"R__active_users.sql": "DROP VIEW IF EXISTS active_users;\nCREATE VIEW active_users AS SELECT id FROM users WHERE active = 1;",
+	})
+	m, err := New(openDB(t), WithDialect("sqlite"), WithDir(dir))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if ran, err := m.UpSteps(ctx, 1); err != nil || len(ran) != 1 || ran[0].Version != 10 {
+		t.Fatalf("repeatables must wait for pending versions: %v %v", versions(ran), err)
+	}
+	ran, err := m.Up(ctx)
+	if err != nil || len(ran) != 2 || ran[0].Version != 20 || !ran[1].Repeatable {
+		t.Fatalf("up: %v %v", versions(ran), err)
+	}
+	st, err := m.Status(ctx)
+	if err != nil || len(st.Repeatables) != 0 || !strings.Contains(st.String(), "R\tactive_users\tup to date") {
+		t.Fatalf("unexpected status: %v %v", st, err)
+	}
+	if ran, err = m.Up(ctx); err != nil || len(ran) != 0 {
+		t.Fatalf("unchanged repeatable ran again: %v %v", versions(ran), err)
+	}
+
+	changed := "DROP VIEW IF EXISTS active_users;\nCREATE VIEW active_users AS SELECT id, active FROM users WHERE active = 1;"
+	if err := os.WriteFile(filepath.Join(dir, "R__active_users.sql"), []byte(changed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if st, err = m.Status(ctx); err != nil || len(st.Repeatables) != 1 || len(st.Mismatches) != 0 || !strings.Contains(st.String(), "R\tactive_users\tchanged") {
+		t.Fatalf("unexpected status after change: %v %v", st, err)
+	}
+	if ran, err = m.Up(ctx); err != nil || len(ran) != 1 || !ran[0].Repeatable {
+		t.Fatalf("changed repeatable did not run: %v %v", versions(ran), err)
+	}
+	if _, err := m.db.ExecContext(ctx, "SELECT active FROM active_users"); err != nil {
+		t.Fatalf("view not recreated: %v", err)
+	}
+	history, err := m.History(ctx)
+	if err != nil || len(history) != 3 {
+		t.Fatalf("expected one row per migration, got %v %v", history, err)
+	}
+}
+
+func TestMigratorGoMigrations(t *testing.T) {
+	ctx := context.Background()
+	dir := writeMigrations(t, map[string]string{
+		"0010_init.up.sql":     "CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT);\nINSERT INTO users (email) VALUES ('Ada@Example.com');",
+		"0030_unique.up.sql":   "CREATE UNIQUE INDEX users_email ON users (email);",
+		"0030_unique.down.sql": "DROP INDEX users_email;",
+	})
+	var calls int
+	backfill := MigrationFunc(func(ctx context.Context, c Conn) error {
+		calls++
+		_, err := c.ExecContext(ctx, "UPDATE users SET email = lower(email)")
+		return err
+	})
+	m, err := New(openDB(t), WithDialect("sqlite"), WithDir(dir), WithMigration(20, "normalize_emails", backfill))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if plan, err := m.PlanUp(ctx, 0); err != nil || calls != 0 || !strings.Contains(plan.String(), "up 0020 normalize_emails (go)") {
+		t.Fatalf("plan: %v %v (calls %d)", plan, err, calls)
+	}
+	ran, err := m.Up(ctx)
+	if err != nil || len(versions(ran)) != 3 || ran[1].Version != 20 || calls != 1 {
+		t.Fatalf("up: %v %v (calls %d)", versions(ran), err, calls)
+	}
+	var email string
+	if err := m.db.QueryRowContext(ctx, "SELECT email FROM users").Scan(&email); err != nil || email != "ada@example.com" {
+		t.Fatalf("backfill did not run: %q %v", email, err)
+	}
+	if st, err := m.Status(ctx); err != nil || !strings.Contains(st.String(), "0020\tnormalize_emails\tapplied") || len(st.Mismatches) != 0 {
+		t.Fatalf("unexpected status: %v %v", st, err)
+	}
+	if _, err := m.To(ctx, 10); err == nil || !strings.Contains(err.Error(), "no down migration for version(s) 0020") {
+		t.Fatalf("expected irreversible Go migration to block To, got %v", err)
+	}
+	if _, err := Run(ctx, openDB(t), WithDialect("sqlite"), WithDir(dir), WithMigration(30, "clash", backfill)); err == nil || !strings.Contains(err.Error(), "version already used") {
+		t.Fatalf("expected version clash error, got %v", err)
+	}
+}
+
+func TestMigratorDialectVariants(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(openDB(t), WithDialect("sqlite"), WithDir(writeMigrations(t, map[string]string{
+		"0010_init.up.sql":        "CREATE TABLE users (id INTEGER PRIMARY KEY);",
+		"0010_init.up.sqlite.sql": "CREATE TABLE users (id INTEGER PRIMARY KEY) STRICT;",
+		"0010_init.up.hana.sql":   "CREATE COLUMN TABLE users (id INTEGER PRIMARY KEY);",
+	})))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ran, err := m.Up(ctx)
+	if err != nil || len(ran) != 1 || ran[0].Dialect != "sqlite" {
+		t.Fatalf("up: %+v %v", ran, err)
+	}
+	var ddl string
+	if err := m.db.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE name = 'users'").Scan(&ddl); err != nil || !strings.HasSuffix(ddl, "STRICT") {
+		t.Fatalf("generic file used instead of the sqlite variant: %q %v", ddl, err)
+	}
+	if st, err := m.Status(ctx); err != nil || !strings.Contains(st.String(), "0010\tinit [sqlite]\tapplied") {
+		t.Fatalf("unexpected status: %v %v", st, err)
+	}
+}
+
+func TestGenerateScript(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_init.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"0010_init.down.sql": {Data: []byte("DROP TABLE users;")},
+		"0020_more.up.sql":   {Data: []byte("CREATE TABLE orders (id INT);")},
+	}
+	script, err := GenerateScript(ScriptOptions{To: 10}, WithDialect("hana"), WithFS(fsys, "."))
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if !strings.Contains(script, "EXEC 'CREATE TABLE users (id INT)';") || strings.Contains(script, "orders") {
+		t.Fatalf("unexpected script:\n%s", script)
+	}
+	if _, err := GenerateScript(ScriptOptions{Down: true}, WithDialect("hana"), WithFS(fsys, ".")); err == nil {
+		t.Fatalf("expected error for missing down file")
+	}
+	if _, err := GenerateScript(ScriptOptions{}, WithFS(fsys, ".")); err == nil {
+		t.Fatalf("expected error without dialect")
+	}
+}
+
+// renamedDialect registers an existing dialect under another name, as a third party would.
+type renamedDialect struct{ dialect.SQLiteDialect }
+
+func (renamedDialect) Name() string { return "embedded" }
+
+func TestRegisterDialect(t *testing.T) {
+	if _, err := New(openDB(t), WithDialect("embedded")); err == nil {
+		t.Fatalf("expected unknown dialect error")
+	}
+	RegisterDialect(renamedDialect{})
+	m, err := New(openDB(t), WithDialect("embedded"), WithDir(writeMigrations(t, testMigrations)))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if ran, err := m.Up(context.Background()); err != nil || len(ran) != 3 {
+		t.Fatalf("up: %v %v", versions(ran), err)
+	}
+}
+
+func TestMigratorErrors(t *testing.T) {
+	if _, err := New(openDB(t)); err == nil {
+		t.Fatalf("expected missing dialect error")
+	}
+	m, err := New(openDB(t), WithDialect("sqlite"), WithDir(writeMigrations(t, map[string]string{
+		"0010_bad.up.sql": "CREATE TABLE t (id INTEGER);\nINSERT INTO nope VALUES (1);",
+	})))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = m.Up(context.Background())
+	var me *MigrationError
+	if !errors.As(err, &me) || me.Line != 2 {
+		t.Fatalf("expected MigrationError at line 2, got %v", err)
+	}
+}
+
+func TestMigratorSourcePrecedence(t *testing.T) {
+	embedded := fstest.MapFS{
+		"migrations/0010_embedded.up.sql": {Data: []byte("CREATE TABLE embedded (id INTEGER);")},
+	}
+	onDisk := writeMigrations(t, map[string]string{"0010_disk.up.sql": "CREATE TABLE disk (id INTEGER);"})
+
+	m, err := New(openDB(t), WithDialect("sqlite"), WithDir(onDisk), WithFS(embedded, "migrations"))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	pairs, err := m.Migrations()
+	if err != nil || len(pairs) != 1 || pairs[0].Up.Name != "embedded" {
+		t.Fatalf("expected embedded source to win: %+v %v", pairs, err)
+	}
+
+	m, err = New(openDB(t), WithDialect("sqlite"), WithFS(embedded, "migrations"), WithDir(onDisk))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if ran, err := m.Up(context.Background()); err != nil || len(ran) != 1 || ran[0].Name != "disk" {
+		t.Fatalf("expected disk source to win: %v %v", ran, err)
+	}
+}
+
+func TestMigratorLogEvents(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	m, err := New(openDB(t), WithDialect("sqlite"), WithDir(writeMigrations(t, map[string]string{
+		"0010_init.up.sql": "CREATE TABLE users (id INTEGER PRIMARY KEY);\nCREATE INDEX users_id ON users (id);",
+		"0020_bad.up.sql":  "INSERT INTO nope VALUES (1);",
+	})), WithLogHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := m.Up(ctx); err == nil {
+		t.Fatalf("expected failure of 0020")
+	}
+	var events []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e struct {
+			Msg       string `json:"msg"`
+			Version   string `json:"version"`
+			Statement int    `json:"statement"`
+		}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("decode %s: %v", line, err)
+		}
+		events = append(events, strings.TrimSpace(fmt.Sprintf("%s %s", e.Msg, e.Version)))
+	}
+	want := "lock acquired,plan computed,migration started 0010,statement executed 0010,statement executed 0010,migration finished 0010,migration started 0020,migration failed 0020"
+	if strings.Join(events, ",") != want {
+		t.Fatalf("unexpected events:\n%s", strings.Join(events, "\n"))
+	}
+
+	var lines logLines
+	m, err = New(openDB(t), WithDialect("sqlite"), WithDir(writeMigrations(t, testMigrations)), WithLogger(&lines))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := m.UpSteps(ctx, 1); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(lines) != 4 || !strings.HasPrefix(lines[3], `level=INFO msg="migration finished" version=0010 name=init direction=up duration=`) {
+		t.Fatalf("unexpected log lines: %q", lines)
+	}
+}
+
+type logLines []string
+
+func (l *logLines) Printf(format string, v ...any) { *l = append(*l, fmt.Sprintf(format, v...)) }
+
+// deployTracker records finished migrations, as a hook posting to a tracker would.
+type deployTracker struct {
+	NoHooks
+	finished []string
+}
+
+func (d *deployTracker) AfterMigration(_ context.Context, _ Conn, f Migration, _ time.Duration) error {
+	d.finished = append(d.finished, f.Direction+" "+f.Name)
+	return nil
+}
+
+func TestMigratorHooks(t *testing.T) {
+	ctx := context.Background()
+	files := map[string]string{"afterMigrate.sql": "CREATE TABLE IF NOT EXISTS runs (id INTEGER);\nINSERT INTO runs VALUES (1);"}
+	for name, content := range testMigrations {
+		files[name] = content
+	}
+	db := openDB(t)
+	tracker := &deployTracker{}
+	m, err := New(db, WithDialect("sqlite"), WithDir(writeMigrations(t, files)), WithHooks(tracker))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if _, err := m.Down(ctx, 1); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if got := strings.Join(tracker.finished, ","); got != "up init,up email,up orders,down orders,up orders" {
+		t.Fatalf("unexpected hook calls: %s", got)
+	}
+	var runs int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM runs").Scan(&runs); err != nil || runs != 3 {
+		t.Fatalf("afterMigrate.sql ran %d times: %v", runs, err)
+	}
+}
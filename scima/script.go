@@ -0,0 +1,30 @@
+package scima
+
+import "github.com/scima/scima/internal/migrate"
+
+// ScriptOptions selects the migrations GenerateScript renders.
+type ScriptOptions struct {
+	// From and To bound the versions to include; 0 leaves that side open.
+	From, To int64
+	// Down renders the down migrations of the range, newest first, instead of the ups.
+	Down bool
+}
+
+// GenerateScript renders migrations as one SQL script for a DBA to run where scima
+// may not connect. Each migration is guarded by a check of the tracking table, so
+// the script can be rerun. WithDialect is required; no database is needed.
+func GenerateScript(sel ScriptOptions, opts ...Option) (string, error) {
+	m, err := New(nil, opts...)
+	if err != nil {
+		return "", err
+	}
+	pairs, err := m.Migrations()
+	if err != nil {
+		return "", err
+	}
+	files, err := migrate.ScriptRange(pairs, sel.From, sel.To, sel.Down)
+	if err != nil {
+		return "", err
+	}
+	return migrate.GenerateScript(m.dialect, m.opts.schema, files)
+}
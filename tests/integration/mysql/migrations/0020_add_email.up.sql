@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN email VARCHAR(320);
+CREATE INDEX users_email_idx ON users (email);
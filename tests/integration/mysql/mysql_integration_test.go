@@ -0,0 +1,150 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/scima/scima/internal/dialect"
+	"github.com/scima/scima/internal/migrate"
+	tc "github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// Integration test configuration via environment variables:
+//   SCIMA_TEST_MYSQL_IMAGE     (default: mariadb:11)
+//   SCIMA_TEST_MYSQL_PASSWORD  (default: test)
+//   SCIMA_TEST_MYSQL_DB        (default: testdb)
+//   SCIMA_TEST_MYSQL_REGISTRY  (optional, prepends to image if set)
+
+func TestMySQLMigrationsIntegration(t *testing.T) {
+	// ---------------------------------------------------------------------
+	// SETUP: Start ephemeral MariaDB container and establish connection
+	// ---------------------------------------------------------------------
+	ctx := context.Background()
+
+	rootDir := getenvDefault("SCIMA_TEST_ROOT_DIR", ".")
+	migDir := filepath.Join(rootDir, "tests", "integration", "mysql", "migrations")
+	if _, err := os.Stat(migDir); os.IsNotExist(err) {
+		t.Fatalf("migrations folder not found: %s", migDir)
+	}
+	image := getenvDefault("SCIMA_TEST_MYSQL_IMAGE", "mariadb:11")
+	password := getenvDefault("SCIMA_TEST_MYSQL_PASSWORD", "test")
+	dbname := getenvDefault("SCIMA_TEST_MYSQL_DB", "testdb")
+	if registry := os.Getenv("SCIMA_TEST_MYSQL_REGISTRY"); registry != "" {
+		image = registry + "/" + image
+	}
+
+	port := nat.Port("3306/tcp")
+	req := tc.ContainerRequest{
+		Image:        image,
+		ExposedPorts: []string{string(port)},
+		Env: map[string]string{
+			"MARIADB_ROOT_PASSWORD": password,
+			"MARIADB_DATABASE":      dbname,
+		},
+		WaitingFor: wait.ForListeningPort(port).WithStartupTimeout(90 * time.Second),
+	}
+	container, err := tc.GenericContainer(ctx, tc.GenericContainerRequest{ContainerRequest: req, Started: true})
+	if err != nil {
+		t.Fatalf("container start: %v", err)
+	}
+	defer container.Terminate(ctx)
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatalf("host: %v", err)
+	}
+	mappedPort, err := container.MappedPort(ctx, port)
+	if err != nil {
+		t.Fatalf("mapped port: %v", err)
+	}
+	dsn := fmt.Sprintf("root:%s@tcp(%s:%s)/%s", password, host, mappedPort.Port(), dbname)
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	// The port can accept connections before the server finished initialising.
+	deadline := time.Now().Add(60 * time.Second)
+	for err = db.PingContext(ctx); err != nil && time.Now().Before(deadline); err = db.PingContext(ctx) {
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	defer conn.Close()
+
+	// ---------------------------------------------------------------------
+	// MIGRATOR: Acquire dialect and create migrator wrapper
+	// ---------------------------------------------------------------------
+	d, err := dialect.Get("mysql")
+	if err != nil {
+		t.Fatalf("get dialect: %v", err)
+	}
+	migr := migrate.NewMigrator(d, dialect.SQLConn{DB: conn}, "")
+	migr.LockTimeout = 5 * time.Second
+
+	pairs, err := migrate.ScanDir(migDir, "mysql")
+	if err != nil {
+		t.Fatalf("scan migrations: %v", err)
+	}
+	if err := migrate.Validate(pairs); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	// ---------------------------------------------------------------------
+	// EXECUTION: Apply all migrations under the named lock, then revert one
+	// ---------------------------------------------------------------------
+	err = migr.WithLock(ctx, func(ctx context.Context) error {
+		applied, err := migr.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return migr.ApplyUp(ctx, migrate.FilterPending(pairs, applied))
+	})
+	if err != nil {
+		t.Fatalf("apply up: %v", err)
+	}
+	applied, err := migr.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if len(applied) != len(pairs) {
+		t.Fatalf("expected %d applied got %d", len(pairs), len(applied))
+	}
+	if rec := applied[20]; rec.Name != "add_email" || rec.AppliedAt.IsZero() || rec.DBUser == "" || rec.Dirty {
+		t.Fatalf("history row incomplete: %+v", rec)
+	}
+	if err := migr.ApplyDown(ctx, migrate.ReverseForDown(pairs, applied, 1)); err != nil {
+		t.Fatalf("apply down: %v", err)
+	}
+	applied, err = migr.Status(ctx)
+	if err != nil {
+		t.Fatalf("status after down: %v", err)
+	}
+	if _, ok := applied[20]; ok || len(applied) != 1 {
+		t.Fatalf("expected only version 10 applied, got %v", applied)
+	}
+}
+
+func getenvDefault(key, def string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	return v
+}
@@ -105,7 +105,7 @@ func TestPostgresMigrationsIntegration(t *testing.T) {
 	// ---------------------------------------------------------------------
 	// DISCOVERY: Locate migrations directory and parse & validate files
 	// ---------------------------------------------------------------------
-	pairs, err := migrate.ScanDir(migDir)
+	pairs, err := migrate.ScanDir(migDir, "postgres")
 	if err != nil {
 		t.Fatalf("scan migrations: %v", err)
 	}